@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/unchartedsoftware/plog"
+
+	"github.com/phorne-uncharted/proposition-poc/api/util"
+)
+
+const (
+	// APIKeyHeader is the header carrying a static API key.
+	APIKeyHeader = "X-API-Key"
+
+	bearerPrefix = "Bearer "
+)
+
+var (
+	// ErrUnauthorized is returned when a request has no credentials or its
+	// credentials are invalid.
+	ErrUnauthorized = errors.New("missing or invalid credentials")
+)
+
+type principalKey struct{}
+
+// Principal is the caller of a route, named by its API key or by the subject
+// of its token. Sites lists the allowed sites it may crawl, as hostnames or
+// wildcards, no site being open to it when it is empty.
+type Principal struct {
+	ID    string   `json:"id"`
+	Sites []string `json:"sites,omitempty"`
+	Admin bool     `json:"admin,omitempty"`
+}
+
+// Permits returns true if the principal may crawl the hostname. A site of
+// '*' permits every host and a wildcard such as '*.example.com' every
+// subdomain of the domain. A nil principal, for open routes, permits every
+// host.
+func (p *Principal) Permits(host string) bool {
+	if p == nil {
+		return true
+	}
+	_, ok := util.MatchSite(p.Sites, host)
+
+	return ok
+}
+
+// Config names where the API keys and token keys are read from. Tokens are
+// only accepted when there is an HMAC secret or a JWKS file.
+type Config struct {
+	KeysFile string
+	Secret   string
+	JWKSFile string
+	Issuer   string
+	Audience string
+}
+
+// Authenticator checks the credentials of requests against static API keys
+// and bearer tokens.
+type Authenticator struct {
+	keys     map[string]*Principal
+	secret   []byte
+	jwks     map[string]*rsa.PublicKey
+	issuer   string
+	audience string
+}
+
+// apiKey is an API key as read from the keys file.
+type apiKey struct {
+	Key   string   `json:"key"`
+	Sites []string `json:"sites"`
+	Admin bool     `json:"admin"`
+}
+
+// NewAuthenticator loads the API keys and token keys named in the config.
+// Nil is returned when none are configured, leaving the routes open.
+func NewAuthenticator(config Config) (*Authenticator, error) {
+	if config.KeysFile == "" && config.Secret == "" && config.JWKSFile == "" {
+		return nil, nil
+	}
+
+	a := &Authenticator{
+		keys:     map[string]*Principal{},
+		issuer:   config.Issuer,
+		audience: config.Audience,
+	}
+	if config.Secret != "" {
+		a.secret = []byte(config.Secret)
+	}
+
+	if config.KeysFile != "" {
+		log.Infof("loading api keys from file '%s'", config.KeysFile)
+		contents, err := ioutil.ReadFile(config.KeysFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read api keys file")
+		}
+		keys := map[string]*apiKey{}
+		err = json.Unmarshal(contents, &keys)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse api keys file")
+		}
+		for name, k := range keys {
+			if k.Key == "" {
+				return nil, errors.Errorf("api key '%s' is empty", name)
+			}
+			a.keys[k.Key] = &Principal{ID: name, Sites: k.Sites, Admin: k.Admin}
+		}
+	}
+
+	if config.JWKSFile != "" {
+		log.Infof("loading token keys from file '%s'", config.JWKSFile)
+		var err error
+		a.jwks, err = loadJWKS(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// Authenticate returns the principal named by the API key or bearer token of
+// the request. A bearer token is first checked as an API key so clients that
+// only set the authorization header can use their key.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	credential := r.Header.Get(APIKeyHeader)
+	if credential == "" {
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, bearerPrefix) {
+			return nil, ErrUnauthorized
+		}
+		credential = strings.TrimSpace(strings.TrimPrefix(authorization, bearerPrefix))
+	}
+
+	if principal, ok := a.apiKey(credential); ok {
+		return principal, nil
+	}
+	if r.Header.Get(APIKeyHeader) != "" || (a.secret == nil && a.jwks == nil) {
+		return nil, ErrUnauthorized
+	}
+
+	principal, err := a.verifyToken(credential)
+	if err != nil {
+		return nil, errors.Wrapf(ErrUnauthorized, "invalid token: %v", err)
+	}
+
+	return principal, nil
+}
+
+// apiKey returns the principal of the key, comparing every key in constant
+// time.
+func (a *Authenticator) apiKey(credential string) (*Principal, bool) {
+	var match *Principal
+	for key, principal := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(credential)) == 1 {
+			match = principal
+		}
+	}
+
+	return match, match != nil
+}
+
+// NewContext returns a copy of the context holding the principal.
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal of the request, or nil when the routes
+// are open.
+func FromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPrincipalPermits(t *testing.T) {
+	tests := []struct {
+		name  string
+		sites []string
+		host  string
+		want  bool
+	}{
+		{"no sites", nil, "example.com", false},
+		{"empty sites", []string{}, "example.com", false},
+		{"every site", []string{"*"}, "example.com", true},
+		{"exact host", []string{"example.com"}, "example.com", true},
+		{"case insensitive", []string{"Example.COM"}, "example.com", true},
+		{"other host", []string{"example.com"}, "example.org", false},
+		{"subdomain of exact host", []string{"example.com"}, "www.example.com", false},
+		{"wildcard subdomain", []string{"*.example.com"}, "www.example.com", true},
+		{"wildcard nested subdomain", []string{"*.example.com"}, "a.b.example.com", true},
+		{"wildcard bare domain", []string{"*.example.com"}, "example.com", false},
+		{"wildcard suffix only", []string{"*.example.com"}, "badexample.com", false},
+		{"second site", []string{"example.org", "example.com"}, "example.com", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal := &Principal{ID: "test", Sites: test.sites}
+			if got := principal.Permits(test.host); got != test.want {
+				t.Errorf("Permits(%q) with sites %v = %v, want %v", test.host, test.sites, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNilPrincipalPermits(t *testing.T) {
+	var principal *Principal
+	if !principal.Permits("example.com") {
+		t.Error("nil principal of open routes should permit every host")
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	authenticator := &Authenticator{
+		keys: map[string]*Principal{
+			"key-one": {ID: "one", Sites: []string{"example.com"}},
+		},
+	}
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   string
+	}{
+		{"api key header", APIKeyHeader, "key-one", "one"},
+		{"bearer api key", "Authorization", "Bearer key-one", "one"},
+		{"unknown key", APIKeyHeader, "key-two", ""},
+		{"no credentials", "", "", ""},
+		{"basic auth", "Authorization", "Basic a2V5LW9uZQ==", ""},
+		{"token without token keys", "Authorization", "Bearer a.b.c", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, "/site/treemap", nil)
+			if test.header != "" {
+				r.Header.Set(test.header, test.value)
+			}
+			principal, err := authenticator.Authenticate(r)
+			if test.want == "" {
+				if err == nil {
+					t.Errorf("expected an error, got principal %v", principal)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if principal.ID != test.want {
+				t.Errorf("got principal '%s', want '%s'", principal.ID, test.want)
+			}
+		})
+	}
+}
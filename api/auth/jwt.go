@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+var (
+	hmacMethods = []string{"HS256", "HS384", "HS512"}
+	rsaMethods  = []string{"RS256", "RS384", "RS512"}
+)
+
+// tokenClaims are the claims read from a token, the sites and admin flag of
+// the principal along with the registered claims.
+type tokenClaims struct {
+	Sites []string `json:"sites"`
+	Admin bool     `json:"admin"`
+	jwt.RegisteredClaims
+}
+
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+}
+
+// loadJWKS reads the RSA keys of a JWKS file keyed by their key id. Keys of
+// other types are skipped.
+func loadJWKS(filename string) (map[string]*rsa.PublicKey, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read jwks file")
+	}
+	set := struct {
+		Keys []*jwk `json:"keys"`
+	}{}
+	err = json.Unmarshal(contents, &set)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse jwks file")
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.KeyType != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse modulus of key '%s'", k.KeyID)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse exponent of key '%s'", k.KeyID)
+		}
+		keys[k.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks file has no RSA keys")
+	}
+
+	return keys, nil
+}
+
+// verifyToken checks the signature, lifetime, issuer and audience of a JWT
+// and returns the principal it names. HMAC tokens are checked against the
+// secret and RSA tokens against the JWKS keys, only the algorithms of the
+// configured keys being accepted.
+func (a *Authenticator) verifyToken(token string) (*Principal, error) {
+	claims := &tokenClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, a.tokenKey, a.parserOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	return &Principal{ID: claims.Subject, Sites: claims.Sites, Admin: claims.Admin}, nil
+}
+
+// parserOptions requires tokens to expire and to be signed with an algorithm
+// of the configured keys, by and for this server when an issuer and audience
+// are set.
+func (a *Authenticator) parserOptions() []jwt.ParserOption {
+	methods := []string{}
+	if a.secret != nil {
+		methods = append(methods, hmacMethods...)
+	}
+	if a.jwks != nil {
+		methods = append(methods, rsaMethods...)
+	}
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+	}
+	if a.issuer != "" {
+		options = append(options, jwt.WithIssuer(a.issuer))
+	}
+	if a.audience != "" {
+		options = append(options, jwt.WithAudience(a.audience))
+	}
+
+	return options
+}
+
+// tokenKey returns the key to verify the token with for its algorithm, the
+// secret for HMAC tokens and the JWKS key named by the key id for RSA tokens.
+func (a *Authenticator) tokenKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if a.secret == nil {
+			return nil, errors.Errorf("no secret to verify %s tokens", token.Method.Alg())
+		}
+		return a.secret, nil
+	case *jwt.SigningMethodRSA:
+		keyID, _ := token.Header["kid"].(string)
+		key, ok := a.jwks[keyID]
+		if !ok {
+			return nil, errors.Errorf("no key '%s' to verify %s tokens", keyID, token.Method.Alg())
+		}
+		return key, nil
+	}
+
+	return nil, errors.Errorf("unsupported token algorithm '%s'", token.Method.Alg())
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+func testClaims(modify func(claims jwt.MapClaims)) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub":   "client",
+		"iss":   "issuer",
+		"aud":   []string{"other", "poc"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"sites": []string{"example.com"},
+	}
+	if modify != nil {
+		modify(claims)
+	}
+
+	return claims
+}
+
+func signed(t *testing.T, method jwt.SigningMethod, key interface{}, keyID string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if keyID != "" {
+		token.Header["kid"] = keyID
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("unable to sign token: %v", err)
+	}
+
+	return signed
+}
+
+func TestVerifyToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("unable to marshal key: %v", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	both := &Authenticator{
+		secret:   []byte(testSecret),
+		jwks:     map[string]*rsa.PublicKey{"k1": &rsaKey.PublicKey},
+		issuer:   "issuer",
+		audience: "poc",
+	}
+	rsaOnly := &Authenticator{jwks: map[string]*rsa.PublicKey{"k1": &rsaKey.PublicKey}}
+	hmacOnly := &Authenticator{secret: []byte(testSecret)}
+
+	tests := []struct {
+		name          string
+		authenticator *Authenticator
+		token         string
+		valid         bool
+	}{
+		{"HS256", both, signed(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(nil)), true},
+		{"HS512", both, signed(t, jwt.SigningMethodHS512, []byte(testSecret), "", testClaims(nil)), true},
+		{"RS256", both, signed(t, jwt.SigningMethodRS256, rsaKey, "k1", testClaims(nil)), true},
+		{"RS256 only rsa keys", rsaOnly, signed(t, jwt.SigningMethodRS256, rsaKey, "k1", testClaims(nil)), true},
+		{"audience string", both, signed(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(func(c jwt.MapClaims) {
+			c["aud"] = "poc"
+		})), true},
+		{"wrong secret", both, signed(t, jwt.SigningMethodHS256, []byte("other"), "", testClaims(nil)), false},
+		{"wrong rsa key", both, signed(t, jwt.SigningMethodRS256, otherKey, "k1", testClaims(nil)), false},
+		{"unknown key id", both, signed(t, jwt.SigningMethodRS256, rsaKey, "k2", testClaims(nil)), false},
+		{"no key id", both, signed(t, jwt.SigningMethodRS256, rsaKey, "", testClaims(nil)), false},
+		{"hmac signed with public key", rsaOnly, signed(t, jwt.SigningMethodHS256, publicPEM, "k1", testClaims(nil)), false},
+		{"hmac signed with public key and secret", both, signed(t, jwt.SigningMethodHS256, publicPEM, "k1", testClaims(nil)), false},
+		{"hmac without secret", rsaOnly, signed(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(nil)), false},
+		{"rsa without keys", hmacOnly, signed(t, jwt.SigningMethodRS256, rsaKey, "k1", testClaims(nil)), false},
+		{"alg none", both, signed(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", testClaims(nil)), false},
+		{"unsupported algorithm", both, signed(t, jwt.SigningMethodPS256, rsaKey, "k1", testClaims(nil)), false},
+		{"expired", both, signed(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(func(c jwt.MapClaims) {
+			c["exp"] = time.Now().Add(-time.Minute).Unix()
+		})), false},
+		{"no expiry", both, signed(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(func(c jwt.MapClaims) {
+			delete(c, "exp")
+		})), false},
+		{"not valid yet", both, signed(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(func(c jwt.MapClaims) {
+			c["nbf"] = time.Now().Add(time.Hour).Unix()
+		})), false},
+		{"no subject", both, signed(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(func(c jwt.MapClaims) {
+			delete(c, "sub")
+		})), false},
+		{"wrong issuer", both, signed(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(func(c jwt.MapClaims) {
+			c["iss"] = "other"
+		})), false},
+		{"wrong audience", both, signed(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(func(c jwt.MapClaims) {
+			c["aud"] = "other"
+		})), false},
+		{"no audience", both, signed(t, jwt.SigningMethodHS256, []byte(testSecret), "", testClaims(func(c jwt.MapClaims) {
+			delete(c, "aud")
+		})), false},
+		{"not a token", both, "not-a-token", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal, err := test.authenticator.verifyToken(test.token)
+			if !test.valid {
+				if err == nil {
+					t.Errorf("expected an error, got principal %v", principal)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if principal.ID != "client" || len(principal.Sites) != 1 || principal.Sites[0] != "example.com" {
+				t.Errorf("unexpected principal %+v", principal)
+			}
+		})
+	}
+}
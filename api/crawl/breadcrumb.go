@@ -0,0 +1,269 @@
+package crawl
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	breadcrumbListType = "BreadcrumbList"
+)
+
+var (
+	breadcrumbNavSelectors = []string{
+		`nav[aria-label="breadcrumb"]`,
+		`nav[aria-label="Breadcrumb"]`,
+		`nav[aria-label="breadcrumbs"]`,
+		`nav[aria-label="Breadcrumbs"]`,
+		`.breadcrumb`,
+		`.breadcrumbs`,
+	}
+)
+
+// Crumb is one step of the breadcrumb trail a page publishes for itself.
+type Crumb struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+// extractBreadcrumb returns the breadcrumb trail of the page, reading JSON-LD
+// first, then microdata and finally breadcrumb navigation markup. The crumb
+// urls are left as they appear on the page.
+func extractBreadcrumb(doc *goquery.Document) []*Crumb {
+	if doc == nil {
+		return nil
+	}
+
+	extractors := []func(*goquery.Document) []*Crumb{
+		jsonLDBreadcrumb,
+		microdataBreadcrumb,
+		navBreadcrumb,
+	}
+	for _, extract := range extractors {
+		if crumbs := extract(doc); len(crumbs) > 0 {
+			return crumbs
+		}
+	}
+
+	return nil
+}
+
+type positionedCrumb struct {
+	crumb    *Crumb
+	position float64
+}
+
+// sortCrumbs orders the crumbs by their list position, keeping the page order
+// for crumbs without one, and drops crumbs without a name.
+func sortCrumbs(positioned []*positionedCrumb) []*Crumb {
+	sort.SliceStable(positioned, func(i, j int) bool {
+		return positioned[i].position < positioned[j].position
+	})
+
+	crumbs := []*Crumb{}
+	for _, p := range positioned {
+		p.crumb.Name = cleanLabel(p.crumb.Name)
+		p.crumb.URL = strings.TrimSpace(p.crumb.URL)
+		if p.crumb.Name != "" {
+			crumbs = append(crumbs, p.crumb)
+		}
+	}
+
+	return crumbs
+}
+
+func jsonLDBreadcrumb(doc *goquery.Document) []*Crumb {
+	var crumbs []*Crumb
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		var data interface{}
+		if json.Unmarshal([]byte(s.Text()), &data) != nil {
+			return true
+		}
+		list := findJSONLDType(data, breadcrumbListType)
+		if list == nil {
+			return true
+		}
+		items, _ := list["itemListElement"].([]interface{})
+		positioned := []*positionedCrumb{}
+		for i, item := range items {
+			element, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			crumb := &Crumb{Name: jsonLDString(element["name"])}
+			switch target := element["item"].(type) {
+			case string:
+				crumb.URL = target
+			case map[string]interface{}:
+				crumb.URL = jsonLDString(target["@id"])
+				if crumb.URL == "" {
+					crumb.URL = jsonLDString(target["url"])
+				}
+				if crumb.Name == "" {
+					crumb.Name = jsonLDString(target["name"])
+				}
+			}
+			position, err := strconv.ParseFloat(jsonLDString(element["position"]), 64)
+			if err != nil {
+				position = float64(i)
+			}
+			positioned = append(positioned, &positionedCrumb{crumb, position})
+		}
+		crumbs = sortCrumbs(positioned)
+		return len(crumbs) == 0
+	})
+
+	return crumbs
+}
+
+// findJSONLDType searches the JSON-LD data, including any @graph, for the
+// first object of the type.
+func findJSONLDType(data interface{}, typeName string) map[string]interface{} {
+	switch d := data.(type) {
+	case []interface{}:
+		for _, v := range d {
+			if found := findJSONLDType(v, typeName); found != nil {
+				return found
+			}
+		}
+	case map[string]interface{}:
+		if jsonLDIsType(d["@type"], typeName) {
+			return d
+		}
+		if graph, ok := d["@graph"]; ok {
+			return findJSONLDType(graph, typeName)
+		}
+	}
+
+	return nil
+}
+
+func jsonLDIsType(value interface{}, typeName string) bool {
+	switch t := value.(type) {
+	case string:
+		return t == typeName || strings.HasSuffix(t, "/"+typeName)
+	case []interface{}:
+		for _, v := range t {
+			if jsonLDIsType(v, typeName) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func jsonLDString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return ""
+}
+
+func microdataBreadcrumb(doc *goquery.Document) []*Crumb {
+	list := doc.Find(`[itemtype$="schema.org/BreadcrumbList"]`).First()
+	positioned := []*positionedCrumb{}
+	list.Find(`[itemprop="itemListElement"]`).Each(func(i int, s *goquery.Selection) {
+		crumb := &Crumb{}
+		name := s.Find(`[itemprop="name"]`).First()
+		crumb.Name = name.AttrOr("content", name.Text())
+		item := s.Find(`[itemprop="item"]`).First()
+		if s.Is(`[itemprop~="item"]`) {
+			item = s
+		}
+		for _, attr := range []string{"href", "itemid", "content"} {
+			if u, ok := item.Attr(attr); ok {
+				crumb.URL = u
+				break
+			}
+		}
+		position, err := strconv.ParseFloat(s.Find(`[itemprop="position"]`).First().AttrOr("content", ""), 64)
+		if err != nil {
+			position = float64(i)
+		}
+		positioned = append(positioned, &positionedCrumb{crumb, position})
+	})
+
+	return sortCrumbs(positioned)
+}
+
+func navBreadcrumb(doc *goquery.Document) []*Crumb {
+	for _, selector := range breadcrumbNavSelectors {
+		nav := doc.Find(selector).First()
+		if nav.Length() == 0 {
+			continue
+		}
+		steps := nav.Find("li")
+		if steps.Length() == 0 {
+			steps = nav.Find("a")
+		}
+		positioned := []*positionedCrumb{}
+		steps.Each(func(i int, s *goquery.Selection) {
+			link := s.Find("a").First()
+			if s.Is("a") {
+				link = s
+			}
+			crumb := &Crumb{
+				Name: s.Text(),
+				URL:  link.AttrOr("href", ""),
+			}
+			positioned = append(positioned, &positionedCrumb{crumb, float64(i)})
+		})
+		if crumbs := sortCrumbs(positioned); len(crumbs) > 0 {
+			return crumbs
+		}
+	}
+
+	return nil
+}
+
+// resolveBreadcrumb makes the crumb urls absolute, canonicalising those on
+// the same site as the page.
+func (c *crawler) resolveBreadcrumb(crumbs []*Crumb, page *url.URL) []*Crumb {
+	for _, crumb := range crumbs {
+		if crumb.URL == "" {
+			continue
+		}
+		resolved, err := page.Parse(crumb.URL)
+		if err != nil {
+			crumb.URL = ""
+			continue
+		}
+		if strings.EqualFold(resolved.Hostname(), c.root.Hostname()) {
+			resolved = c.canonical(resolved)
+		}
+		crumb.URL = resolved.String()
+	}
+
+	return crumbs
+}
+
+// trail returns the crumbs above the page itself, dropping the final crumb
+// when it names the page.
+func (p *Proposition) trail() []*Crumb {
+	crumbs := p.Breadcrumb
+	if n := len(crumbs); n > 0 && (crumbs[n-1].URL == "" || crumbs[n-1].URL == p.URL) {
+		crumbs = crumbs[:n-1]
+	}
+
+	return crumbs
+}
+
+// Name returns the name of the page in its own breadcrumb, falling back to
+// its tag when it publishes none.
+func (p *Proposition) Name() string {
+	if n := len(p.Breadcrumb); n > 0 && len(p.trail()) < n {
+		return p.Breadcrumb[n-1].Name
+	}
+
+	return p.Tag
+}
@@ -0,0 +1,198 @@
+package crawl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"sync"
+	"time"
+
+	log "github.com/unchartedsoftware/plog"
+)
+
+// ResultCache holds recent crawl results so the same site crawled with the
+// same options is only crawled once within the ttl. Results are keyed by the
+// canonical root url and the options that change what the crawl finds, other
+// than the depth: a deeper crawl is trimmed to the depth asked for, so views
+// rendering the same site to different depths share a crawl. A deeper crawl
+// stopped by a limit other than the depth may have missed shallow pages, so
+// it is only used for its own depth.
+type ResultCache struct {
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*cacheEntry
+	lock       *sync.Mutex
+}
+
+type cacheEntry struct {
+	result  *Result
+	depth   int
+	depths  map[string]int
+	expires time.Time
+}
+
+// cacheOptions are the options a cached result must have been crawled with,
+// including the url and title rules of the site so a result crawled before the
+// rules were reloaded is not used. The politeness settings and the owner do
+// not change what is found.
+type cacheOptions struct {
+	UserAgent     string
+	RespectRobots bool
+	MaxPages      int
+	MaxDuration   time.Duration
+	MaxBytes      int64
+	Sitemap       string
+	Canonical     *CanonicalRules
+	Titles        *TitleRules
+	Labels        []string
+	LabelRule     string
+	IDs           string
+	StartURLs     []string
+}
+
+// NewResultCache returns a cache keeping results for the ttl, holding no more
+// than the max entries when it is set.
+func NewResultCache(ttl time.Duration, maxEntries int) *ResultCache {
+	return &ResultCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    map[string]*cacheEntry{},
+		lock:       &sync.Mutex{},
+	}
+}
+
+// Get returns the cached result for the root and options if it has not
+// expired and can be used for the depth of the options, trimmed to that depth.
+func (c *ResultCache) Get(root *url.URL, options Options) (*Result, bool) {
+	key := cacheKey(root, options)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	if !entry.serves(options.MaxDepth) {
+		return nil, false
+	}
+
+	return entry.trimmed(options.MaxDepth), true
+}
+
+// Put caches the result for the root and options, given the depth each page
+// was crawled at, making room for it by dropping the expired entries and then
+// the entries closest to expiring. A deeper result already cached that can be
+// used for the depth of the options is kept instead.
+func (c *ResultCache) Put(root *url.URL, options Options, result *Result, depths map[string]int) {
+	key := cacheKey(root, options)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	existing, replacing := c.entries[key]
+	if replacing && existing.depth != options.MaxDepth && existing.serves(options.MaxDepth) {
+		return
+	}
+	for c.maxEntries > 0 && !replacing && len(c.entries) >= c.maxEntries {
+		oldest := ""
+		for k, entry := range c.entries {
+			if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[key] = &cacheEntry{result: result, depth: options.MaxDepth, depths: depths, expires: now.Add(c.ttl)}
+}
+
+// serves returns true if the entry can be used for a crawl to the depth, which
+// it can when crawled to the same depth or deeper without being stopped by a
+// limit other than the depth.
+func (e *cacheEntry) serves(depth int) bool {
+	if e.depth == depth {
+		return true
+	}
+	if e.depth > 0 && (depth == 0 || depth > e.depth) {
+		return false
+	}
+	limit := ""
+	if e.result.Metadata != nil {
+		limit = e.result.Metadata.LimitReached
+	}
+
+	return limit == "" || limit == LimitDepth
+}
+
+// trimmed returns the result without the pages crawled below the depth, along
+// with the links to and from them. Pages of unknown depth are kept.
+func (e *cacheEntry) trimmed(depth int) *Result {
+	if depth == 0 || depth == e.depth {
+		return e.result
+	}
+
+	kept := map[string]bool{}
+	trimmed := &Result{Propositions: []*Proposition{}, Links: []*Link{}}
+	for _, p := range e.result.Propositions {
+		if d, ok := e.depths[p.URL]; !ok || d <= depth {
+			kept[p.URL] = true
+			trimmed.Propositions = append(trimmed.Propositions, p)
+		}
+	}
+	for _, link := range e.result.Links {
+		if kept[link.Source] && kept[link.Target] {
+			trimmed.Links = append(trimmed.Links, link)
+		}
+	}
+	if e.result.Metadata != nil {
+		metadata := *e.result.Metadata
+		metadata.PageCount = len(trimmed.Propositions)
+		if len(trimmed.Propositions) < len(e.result.Propositions) {
+			metadata.LimitReached = LimitDepth
+		}
+		trimmed.Metadata = &metadata
+	}
+
+	return trimmed
+}
+
+// cacheKey returns the canonical root url followed by a hash of the options.
+func cacheKey(root *url.URL, options Options) string {
+	canonical := options.Canonical
+	if canonical == nil {
+		canonical = DefaultCanonicalRules()
+	}
+	titles := options.Titles
+	if titles == nil {
+		titles = DefaultTitleRules()
+	}
+	bytes, err := json.Marshal(&cacheOptions{
+		UserAgent:     options.UserAgent,
+		RespectRobots: options.RespectRobots,
+		MaxPages:      options.MaxPages,
+		MaxDuration:   options.MaxDuration,
+		MaxBytes:      options.MaxBytes,
+		Sitemap:       options.Sitemap,
+		Canonical:     canonical,
+		Titles:        titles,
+		Labels:        options.Labels,
+		LabelRule:     options.LabelRule,
+		IDs:           options.IDs,
+		StartURLs:     options.StartURLs,
+	})
+	if err != nil {
+		log.Warnf("unable to hash crawl options: %v", err)
+	}
+	hash := sha256.Sum256(bytes)
+
+	return canonical.Canonicalise(root).String() + " " + hex.EncodeToString(hash[:])
+}
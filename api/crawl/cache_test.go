@@ -0,0 +1,186 @@
+package crawl
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("unable to parse '%s': %v", rawURL, err)
+	}
+
+	return u
+}
+
+func TestCacheKey(t *testing.T) {
+	root := "https://example.com/shop"
+	options := Options{UserAgent: "poc", RespectRobots: true, MaxDepth: 3, MaxPages: 100, IDs: IDURL}
+	tests := []struct {
+		name    string
+		root    string
+		options func(o Options) Options
+		same    bool
+	}{
+		{"same", root, func(o Options) Options { return o }, true},
+		{"url alias", "HTTPS://Example.com:443/shop/?utm_source=x#top", func(o Options) Options { return o }, true},
+		{"depth", root, func(o Options) Options { o.MaxDepth = 5; return o }, true},
+		{"delay", root, func(o Options) Options { o.Delay = time.Second; return o }, true},
+		{"parallelism", root, func(o Options) Options { o.Parallelism = 4; return o }, true},
+		{"owner", root, func(o Options) Options { o.Owner = "other"; return o }, true},
+		{"default canonical rules", root, func(o Options) Options { o.Canonical = DefaultCanonicalRules(); return o }, true},
+		{"default title rules", root, func(o Options) Options { o.Titles = DefaultTitleRules(); return o }, true},
+		{"other page", "https://example.com/help", func(o Options) Options { return o }, false},
+		{"other scheme", "http://example.com/shop", func(o Options) Options { return o }, false},
+		{"max pages", root, func(o Options) Options { o.MaxPages = 50; return o }, false},
+		{"user agent", root, func(o Options) Options { o.UserAgent = "other"; return o }, false},
+		{"robots", root, func(o Options) Options { o.RespectRobots = false; return o }, false},
+		{"sitemap", root, func(o Options) Options { o.Sitemap = SitemapSeed; return o }, false},
+		{"ids", root, func(o Options) Options { o.IDs = IDRandom; return o }, false},
+		{"labels", root, func(o Options) Options { o.Labels = []string{"shop"}; return o }, false},
+		{"start urls", root, func(o Options) Options { o.StartURLs = []string{"/help"}; return o }, false},
+		{"canonical rules", root, func(o Options) Options {
+			o.Canonical = DefaultCanonicalRules()
+			o.Canonical.TrimTrailingSlash = false
+			return o
+		}, false},
+		{"title rules", root, func(o Options) Options {
+			o.Titles = DefaultTitleRules()
+			o.Titles.Learn = !o.Titles.Learn
+			return o
+		}, false},
+	}
+	want := cacheKey(mustParseURL(t, root), options)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := cacheKey(mustParseURL(t, test.root), test.options(options))
+			if (got == want) != test.same {
+				t.Errorf("got key '%s' for '%s', want the same key %v", got, test.root, test.same)
+			}
+		})
+	}
+}
+
+// depthResult returns a crawl to the depth of a root, a page below it and a
+// page below that, along with the depth each page was crawled at.
+func depthResult(limit string) (*Result, map[string]int) {
+	result := &Result{
+		Metadata: &Metadata{ID: "crawl", PageCount: 3, LimitReached: limit},
+		Propositions: []*Proposition{
+			{URL: "https://example.com/"},
+			{URL: "https://example.com/a", ParentURL: "https://example.com/"},
+			{URL: "https://example.com/a/b", ParentURL: "https://example.com/a"},
+		},
+		Links: []*Link{
+			{Source: "https://example.com/", Target: "https://example.com/a"},
+			{Source: "https://example.com/a", Target: "https://example.com/a/b"},
+			{Source: "https://example.com/a/b", Target: "https://example.com/"},
+		},
+	}
+	depths := map[string]int{"https://example.com/": 0, "https://example.com/a": 1, "https://example.com/a/b": 2}
+
+	return result, depths
+}
+
+func TestResultCacheDepth(t *testing.T) {
+	root := mustParseURL(t, "https://example.com/")
+	tests := []struct {
+		name   string
+		depth  int
+		limit  string
+		get    int
+		hit    bool
+		pages  int
+		links  int
+		reason string
+	}{
+		{"same depth", 2, "", 2, true, 3, 3, ""},
+		{"shallower", 2, "", 1, true, 2, 1, LimitDepth},
+		{"deeper", 2, "", 3, false, 0, 0, ""},
+		{"unlimited", 2, "", 0, false, 0, 0, ""},
+		{"unlimited crawl", 0, "", 1, true, 2, 1, LimitDepth},
+		{"unlimited crawl to any depth", 0, "", 0, true, 3, 3, ""},
+		{"depth limited and shallower", 2, LimitDepth, 1, true, 2, 1, LimitDepth},
+		{"page limited and same depth", 2, LimitPages, 2, true, 3, 3, LimitPages},
+		{"page limited and shallower", 2, LimitPages, 1, false, 0, 0, ""},
+		{"byte limited and shallower", 0, LimitBytes, 1, false, 0, 0, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewResultCache(time.Hour, 0)
+			result, depths := depthResult(test.limit)
+			cache.Put(root, Options{MaxDepth: test.depth}, result, depths)
+
+			cached, ok := cache.Get(root, Options{MaxDepth: test.get})
+			if ok != test.hit {
+				t.Fatalf("got hit %v, want %v", ok, test.hit)
+			}
+			if !ok {
+				return
+			}
+			if len(cached.Propositions) != test.pages || len(cached.Links) != test.links {
+				t.Errorf("got %d pages and %d links, want %d and %d", len(cached.Propositions), len(cached.Links), test.pages, test.links)
+			}
+			if cached.Metadata.PageCount != test.pages || cached.Metadata.LimitReached != test.reason {
+				t.Errorf("got metadata %+v, want %d pages and limit '%s'", cached.Metadata, test.pages, test.reason)
+			}
+			if len(result.Propositions) != 3 || result.Metadata.PageCount != 3 {
+				t.Error("the cached result was changed")
+			}
+		})
+	}
+}
+
+func TestResultCachePutKeepsDeeper(t *testing.T) {
+	root := mustParseURL(t, "https://example.com/")
+	cache := NewResultCache(time.Hour, 0)
+	deep, depths := depthResult("")
+	cache.Put(root, Options{MaxDepth: 2}, deep, depths)
+	shallow, _ := depthResult("")
+	cache.Put(root, Options{MaxDepth: 1}, shallow, depths)
+	if cached, ok := cache.Get(root, Options{MaxDepth: 2}); !ok || cached != deep {
+		t.Error("the deeper crawl was replaced by a shallower one")
+	}
+
+	// a deeper crawl that cannot be used for the shallower depth is replaced
+	limited, _ := depthResult(LimitPages)
+	cache.Put(root, Options{MaxDepth: 3}, limited, depths)
+	cache.Put(root, Options{MaxDepth: 1}, shallow, depths)
+	if cached, ok := cache.Get(root, Options{MaxDepth: 1}); !ok || cached != shallow {
+		t.Error("the page limited crawl was kept over a complete one")
+	}
+
+	// as is an expired deeper crawl
+	cache.Put(root, Options{MaxDepth: 3}, deep, depths)
+	cache.entries[cacheKey(root, Options{})].expires = time.Now().Add(-time.Second)
+	cache.Put(root, Options{MaxDepth: 1}, shallow, depths)
+	if cached, ok := cache.Get(root, Options{MaxDepth: 1}); !ok || cached != shallow {
+		t.Error("the expired crawl was kept")
+	}
+}
+
+func TestResultCacheExpiry(t *testing.T) {
+	root := mustParseURL(t, "https://example.com/")
+	cache := NewResultCache(time.Hour, 2)
+	cache.Put(root, Options{MaxPages: 1}, &Result{}, nil)
+	cache.Put(root, Options{MaxPages: 2}, &Result{}, nil)
+	cache.entries[cacheKey(root, Options{MaxPages: 1})].expires = time.Now().Add(-time.Second)
+	if _, ok := cache.Get(root, Options{MaxPages: 1}); ok {
+		t.Error("expired result was returned")
+	}
+
+	// the result closest to expiring makes room for a new one
+	cache.Put(root, Options{MaxPages: 3}, &Result{}, nil)
+	cache.entries[cacheKey(root, Options{MaxPages: 3})].expires = time.Now().Add(2 * time.Hour)
+	cache.Put(root, Options{MaxPages: 4}, &Result{}, nil)
+	if len(cache.entries) != 2 {
+		t.Errorf("got %d entries, want 2", len(cache.entries))
+	}
+	for pages, want := range map[int]bool{2: false, 3: true, 4: true} {
+		if _, ok := cache.Get(root, Options{MaxPages: pages}); ok != want {
+			t.Errorf("result for %d pages cached %v, want %v", pages, ok, want)
+		}
+	}
+}
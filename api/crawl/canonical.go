@@ -0,0 +1,170 @@
+package crawl
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	defaultStripParams = []string{
+		"utm_*", "gclid", "dclid", "fbclid", "msclkid", "yclid", "igshid",
+		"mc_cid", "mc_eid", "_ga", "_gl", "_hsenc", "_hsmkt",
+	}
+	defaultDocuments = []string{
+		"index.html", "index.htm", "index.shtml", "index.php",
+		"default.html", "default.htm", "default.asp", "default.aspx",
+	}
+	defaultPorts = map[string]string{"http": "80", "https": "443"}
+)
+
+// CanonicalRules controls how page urls are canonicalised so the aliases of a
+// page collapse into a single proposition.
+type CanonicalRules struct {
+	// StripParams lists the query parameters to drop. A trailing '*' matches
+	// any parameter starting with the rest of the name.
+	StripParams []string `json:"stripParams"`
+	// SortQuery orders the remaining query parameters by name.
+	SortQuery bool `json:"sortQuery"`
+	// DropFragments removes the '#fragment' from urls.
+	DropFragments bool `json:"dropFragments"`
+	// DefaultDocuments are the file names served for a bare directory, which
+	// are removed from the end of the path.
+	DefaultDocuments []string `json:"defaultDocuments"`
+	// TrimTrailingSlash treats '/a/' and '/a' as the same page.
+	TrimTrailingSlash bool `json:"trimTrailingSlash"`
+	// CanonicalTag uses the page's own <link rel="canonical"> when it is on
+	// the same site.
+	CanonicalTag bool `json:"canonicalTag"`
+	// FollowRedirects identifies a redirected page by the url it ended at.
+	FollowRedirects bool `json:"followRedirects"`
+}
+
+// DefaultCanonicalRules returns the rules used when a site has none of its own.
+func DefaultCanonicalRules() *CanonicalRules {
+	return &CanonicalRules{
+		StripParams:       append([]string{}, defaultStripParams...),
+		SortQuery:         true,
+		DropFragments:     true,
+		DefaultDocuments:  append([]string{}, defaultDocuments...),
+		TrimTrailingSlash: true,
+		CanonicalTag:      true,
+		FollowRedirects:   true,
+	}
+}
+
+// Canonicalise returns the canonical form of the url. The url itself is left
+// unchanged.
+func (r *CanonicalRules) Canonicalise(u *url.URL) *url.URL {
+	c := *u
+	c.Scheme = strings.ToLower(c.Scheme)
+	c.Host = strings.ToLower(c.Host)
+	if port := c.Port(); port != "" && defaultPorts[c.Scheme] == port {
+		c.Host = c.Hostname()
+	}
+	if r.DropFragments {
+		c.Fragment = ""
+	}
+	c.RawQuery = r.canonicalQuery(c.RawQuery)
+
+	// the escaped path is trimmed so escaped slashes are not decoded into
+	// path separators
+	escaped := c.EscapedPath()
+	p := escaped
+	if p == "" {
+		p = "/"
+	}
+	base := path.Base(p)
+	for _, doc := range r.DefaultDocuments {
+		if strings.EqualFold(base, doc) && !strings.HasSuffix(p, "/") {
+			p = strings.TrimSuffix(p, base)
+			break
+		}
+	}
+	if r.TrimTrailingSlash && len(p) > 1 {
+		p = strings.TrimRight(p, "/")
+		if p == "" {
+			p = "/"
+		}
+	}
+	if p != escaped {
+		if unescaped, err := url.PathUnescape(p); err == nil {
+			c.Path = unescaped
+			c.RawPath = p
+		}
+	}
+
+	return &c
+}
+
+func (r *CanonicalRules) canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	// the raw pairs are kept as they are so the encoding of the values does
+	// not change
+	pairs := []string{}
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		if !r.stripParam(queryKey(pair)) {
+			pairs = append(pairs, pair)
+		}
+	}
+	if r.SortQuery {
+		sort.SliceStable(pairs, func(i, j int) bool {
+			return queryKey(pairs[i]) < queryKey(pairs[j])
+		})
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+func (r *CanonicalRules) stripParam(key string) bool {
+	key = strings.ToLower(key)
+	for _, param := range r.StripParams {
+		param = strings.ToLower(param)
+		if strings.HasSuffix(param, "*") {
+			if strings.HasPrefix(key, strings.TrimSuffix(param, "*")) {
+				return true
+			}
+		} else if key == param {
+			return true
+		}
+	}
+
+	return false
+}
+
+func queryKey(pair string) string {
+	key := strings.SplitN(pair, "=", 2)[0]
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		return unescaped
+	}
+
+	return key
+}
+
+// canonicalTag returns the same site url named by the page's
+// <link rel="canonical">, if it has one.
+func canonicalTag(page *url.URL, doc *goquery.Document) *url.URL {
+	if doc == nil {
+		return nil
+	}
+	href, ok := doc.Find(`link[rel~="canonical"]`).First().Attr("href")
+	href = strings.TrimSpace(href)
+	if !ok || href == "" {
+		return nil
+	}
+	canonical, err := page.Parse(href)
+	if err != nil || !strings.EqualFold(canonical.Hostname(), page.Hostname()) {
+		return nil
+	}
+
+	return canonical
+}
@@ -0,0 +1,58 @@
+package crawl
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalise(t *testing.T) {
+	defaults := DefaultCanonicalRules()
+	none := &CanonicalRules{}
+	tests := []struct {
+		name  string
+		rules *CanonicalRules
+		url   string
+		want  string
+	}{
+		{"unchanged", defaults, "https://example.com/a/b", "https://example.com/a/b"},
+		{"case", defaults, "HTTPS://Example.COM/A", "https://example.com/A"},
+		{"default http port", defaults, "http://example.com:80/a", "http://example.com/a"},
+		{"default https port", defaults, "https://example.com:443/a", "https://example.com/a"},
+		{"other port", defaults, "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"fragment", defaults, "https://example.com/a#top", "https://example.com/a"},
+		{"fragment kept", none, "https://example.com/a#top", "https://example.com/a#top"},
+		{"tracking params", defaults, "https://example.com/a?utm_source=x&id=3&gclid=y", "https://example.com/a?id=3"},
+		{"only tracking params", defaults, "https://example.com/a?utm_source=x", "https://example.com/a"},
+		{"param case", defaults, "https://example.com/a?UTM_Medium=x&id=3", "https://example.com/a?id=3"},
+		{"sorted query", defaults, "https://example.com/a?b=2&a=1&c=3", "https://example.com/a?a=1&b=2&c=3"},
+		{"query order kept", none, "https://example.com/a?b=2&a=1", "https://example.com/a?b=2&a=1"},
+		{"query encoding kept", defaults, "https://example.com/a?q=a%20b&p=x+y", "https://example.com/a?p=x+y&q=a%20b"},
+		{"empty pairs", defaults, "https://example.com/a?&a=1&&", "https://example.com/a?a=1"},
+		{"default document", defaults, "https://example.com/shop/index.html", "https://example.com/shop"},
+		{"default document case", defaults, "https://example.com/Index.HTML", "https://example.com/"},
+		{"default document as directory", defaults, "https://example.com/index.html/", "https://example.com/index.html"},
+		{"other document", defaults, "https://example.com/shop/about.html", "https://example.com/shop/about.html"},
+		{"trailing slash", defaults, "https://example.com/shop/", "https://example.com/shop"},
+		{"trailing slashes", defaults, "https://example.com/shop//", "https://example.com/shop"},
+		{"trailing slash kept", none, "https://example.com/shop/", "https://example.com/shop/"},
+		{"root", defaults, "https://example.com", "https://example.com/"},
+		{"root slash", defaults, "https://example.com/", "https://example.com/"},
+		{"escaped path", defaults, "https://example.com/a%20b/", "https://example.com/a%20b"},
+		{"escaped slash", defaults, "https://example.com/a%2Fb/", "https://example.com/a%2Fb"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatalf("unable to parse '%s': %v", test.url, err)
+			}
+			original := u.String()
+			if got := test.rules.Canonicalise(u).String(); got != test.want {
+				t.Errorf("Canonicalise(%s) = '%s', want '%s'", test.url, got, test.want)
+			}
+			if u.String() != original {
+				t.Errorf("the url was changed to '%s'", u.String())
+			}
+		})
+	}
+}
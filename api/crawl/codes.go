@@ -0,0 +1,192 @@
+package crawl
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// CodeSlug builds each code from the slugged tags of the page and the
+	// pages above it, such as TEL.BUS.INSTORE.
+	CodeSlug = "slug"
+	// CodeURLPath builds each code from the segments of the page url path.
+	CodeURLPath = "url-path"
+	// CodeNumbering numbers the pages by their position in the hierarchy,
+	// such as 1.2.3.
+	CodeNumbering = "numbering"
+
+	defaultCodeSeparator = "."
+	codeCollision        = "-"
+	slugSeparator        = "-"
+)
+
+var (
+	// CodeStrategies lists the strategies for generating codes.
+	CodeStrategies = []string{CodeSlug, CodeURLPath, CodeNumbering}
+)
+
+// CodeOptions configures how proposition codes are generated.
+type CodeOptions struct {
+	Strategy string
+	// Separator joins the code segments of each level.
+	Separator string
+	// SegmentLength caps the length of each slugged segment, 0 leaving it
+	// uncapped.
+	SegmentLength int
+}
+
+// AssignCodes sets the code of every proposition in the nodes. Codes are
+// generated level by level below the empty root, so a page's code starts
+// with the code of its parent in every strategy but the url path one. Pages
+// are numbered in url order below their parent, and pages given the same code
+// are told apart by a numbered suffix handed out in url order, so the codes do
+// not depend on the crawl order.
+func AssignCodes(nodes map[string]*Node, options CodeOptions) error {
+	root := nodes[""]
+	if root == nil {
+		return nil
+	}
+	if options.Strategy == "" {
+		options.Strategy = CodeSlug
+	}
+	if options.Separator == "" {
+		options.Separator = defaultCodeSeparator
+	}
+
+	var base func(parent *Node, child *Node, position int) string
+	switch options.Strategy {
+	case CodeSlug:
+		base = func(parent *Node, child *Node, position int) string {
+			return joinCode(parent.Data.Code, codeSlug(child.Data.Name(), options.SegmentLength, position), options.Separator)
+		}
+	case CodeURLPath:
+		base = func(parent *Node, child *Node, position int) string {
+			return urlPathCode(child, options, position)
+		}
+	case CodeNumbering:
+		base = func(parent *Node, child *Node, position int) string {
+			return joinCode(parent.Data.Code, fmt.Sprintf("%d", position), options.Separator)
+		}
+	default:
+		return errors.Errorf("unknown code strategy '%s'", options.Strategy)
+	}
+
+	used := map[string]bool{}
+	level := []*Node{root}
+	for len(level) > 0 {
+		next := []*Node{}
+		coded := []*codedNode{}
+		for _, parent := range level {
+			for i, child := range childrenByKey(parent) {
+				coded = append(coded, &codedNode{child, base(parent, child, i+1)})
+				next = append(next, child)
+			}
+		}
+		assignUnique(coded, used)
+		level = next
+	}
+
+	return nil
+}
+
+// childrenByKey returns the children of the node in key order, so the
+// positions the codes are numbered by do not depend on the crawl order.
+func childrenByKey(node *Node) []*Node {
+	children := append([]*Node{}, node.Neighbours...)
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].Key < children[j].Key
+	})
+
+	return children
+}
+
+type codedNode struct {
+	node *Node
+	code string
+}
+
+// assignUnique sets the codes of a level, numbering repeated codes in url
+// order. A numbered code is checked against the codes already assigned and the
+// codes still to be assigned on the level, since a slug such as A-2 can be the
+// same as a numbered A.
+func assignUnique(coded []*codedNode, used map[string]bool) {
+	sort.SliceStable(coded, func(i, j int) bool {
+		if coded[i].code != coded[j].code {
+			return coded[i].code < coded[j].code
+		}
+		return coded[i].node.Key < coded[j].node.Key
+	})
+
+	pending := map[string]int{}
+	for _, c := range coded {
+		pending[c.code]++
+	}
+
+	for _, c := range coded {
+		pending[c.code]--
+		code := c.code
+		for n := 2; used[code] || (code != c.code && pending[code] > 0); n++ {
+			code = fmt.Sprintf("%s%s%d", c.code, codeCollision, n)
+		}
+		used[code] = true
+		c.node.Data.Code = code
+	}
+}
+
+func joinCode(parent string, segment string, separator string) string {
+	if parent == "" {
+		return segment
+	}
+
+	return parent + separator + segment
+}
+
+// codeSlug turns a name into an upper case code segment, falling back to the
+// page position when the name has no letters or digits.
+func codeSlug(name string, length int, position int) string {
+	if slug := slugWords(name, length); slug != "" {
+		return slug
+	}
+
+	return fmt.Sprintf("%d", position)
+}
+
+func slugWords(name string, length int) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	slug := strings.ToUpper(strings.Join(words, slugSeparator))
+	if length > 0 && len([]rune(slug)) > length {
+		slug = strings.TrimRight(string([]rune(slug)[:length]), slugSeparator)
+	}
+
+	return slug
+}
+
+func urlPathCode(node *Node, options CodeOptions, position int) string {
+	page, err := url.Parse(node.Data.URL)
+	if err != nil || strings.Trim(page.Path, "/") == "" {
+		return codeSlug(node.Data.Name(), options.SegmentLength, position)
+	}
+
+	segments := []string{}
+	for _, s := range strings.Split(strings.Trim(page.Path, "/"), "/") {
+		if unescaped, err := url.PathUnescape(s); err == nil {
+			s = unescaped
+		}
+		if slug := slugWords(strings.TrimSuffix(s, path.Ext(s)), options.SegmentLength); slug != "" {
+			segments = append(segments, slug)
+		}
+	}
+	if len(segments) == 0 {
+		return codeSlug(node.Data.Name(), options.SegmentLength, position)
+	}
+
+	return strings.Join(segments, options.Separator)
+}
@@ -0,0 +1,105 @@
+package crawl
+
+import (
+	"testing"
+)
+
+func TestAssignCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		tags map[string]string
+		want map[string]string
+	}{
+		{
+			"unique",
+			map[string]string{"http://example.com/a": "Shop", "http://example.com/b": "Help desk"},
+			map[string]string{"http://example.com/a": "SHOP", "http://example.com/b": "HELP-DESK"},
+		},
+		{
+			"repeated",
+			map[string]string{"http://example.com/a": "Shop", "http://example.com/b": "Shop", "http://example.com/c": "Shop"},
+			map[string]string{"http://example.com/a": "SHOP", "http://example.com/b": "SHOP-2", "http://example.com/c": "SHOP-3"},
+		},
+		{
+			"slug matching a numbered code",
+			map[string]string{"http://example.com/a": "A", "http://example.com/b": "A", "http://example.com/c": "A 2"},
+			map[string]string{"http://example.com/a": "A", "http://example.com/b": "A-3", "http://example.com/c": "A-2"},
+		},
+		{
+			"slug matching a numbered code and repeated",
+			map[string]string{"http://example.com/a": "A", "http://example.com/b": "A", "http://example.com/c": "A 2", "http://example.com/d": "A-2"},
+			map[string]string{"http://example.com/a": "A", "http://example.com/b": "A-3", "http://example.com/c": "A-2", "http://example.com/d": "A-2-2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			propositions := []*Proposition{{URL: "http://example.com/", Tag: "Home"}}
+			for url, tag := range test.tags {
+				propositions = append(propositions, &Proposition{URL: url, Tag: tag, ParentURL: "http://example.com/"})
+			}
+			nodes := BuildNodes(propositions)
+			err := AssignCodes(nodes, CodeOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			codes := map[string]bool{}
+			for url, node := range nodes {
+				if url == "" {
+					continue
+				}
+				if codes[node.Data.Code] {
+					t.Errorf("code '%s' was given to more than one page", node.Data.Code)
+				}
+				codes[node.Data.Code] = true
+			}
+			for url, want := range test.want {
+				if got := nodes[url].Data.Code; got != "HOME."+want {
+					t.Errorf("'%s' got code '%s', want 'HOME.%s'", url, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAssignCodesCrawlOrder(t *testing.T) {
+	propositions := []*Proposition{
+		{URL: "http://example.com/", Tag: "Home"},
+		{URL: "http://example.com/a", Tag: "Shop", ParentURL: "http://example.com/"},
+		{URL: "http://example.com/b", Tag: "Help", ParentURL: "http://example.com/"},
+		{URL: "http://example.com/c", Tag: "?", ParentURL: "http://example.com/"},
+		{URL: "http://example.com/a/x", Tag: "Phones", ParentURL: "http://example.com/a"},
+		{URL: "http://example.com/a/y", Tag: "Phones", ParentURL: "http://example.com/a"},
+		{URL: "http://example.com/a/z", Tag: "", ParentURL: "http://example.com/a"},
+	}
+	// the same pages visited in another order by a parallel crawl
+	reordered := []*Proposition{propositions[0]}
+	for i := len(propositions) - 1; i > 0; i-- {
+		if propositions[i].ParentURL == "http://example.com/" {
+			reordered = append(reordered, propositions[i])
+		}
+	}
+	for i := len(propositions) - 1; i > 0; i-- {
+		if propositions[i].ParentURL != "http://example.com/" {
+			reordered = append(reordered, propositions[i])
+		}
+	}
+
+	for _, strategy := range CodeStrategies {
+		t.Run(strategy, func(t *testing.T) {
+			first := BuildNodes(propositions)
+			second := BuildNodes(reordered)
+			for _, nodes := range []map[string]*Node{first, second} {
+				err := AssignCodes(nodes, CodeOptions{Strategy: strategy})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			for url, node := range first {
+				if got := second[url].Data.Code; got != node.Data.Code {
+					t.Errorf("'%s' got code '%s' and '%s' in the two crawl orders", url, node.Data.Code, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,525 @@
+package crawl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+	"github.com/gocolly/colly/v2/queue"
+	uuid "github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	log "github.com/unchartedsoftware/plog"
+)
+
+const (
+	fetchTimeout = 30 * time.Second
+
+	skipRobots    = "robots.txt"
+	skipDuplicate = "duplicate"
+)
+
+// PageEvent describes a page handled by the crawl.
+type PageEvent struct {
+	URL        string `json:"url"`
+	ParentURL  string `json:"parentUrl"`
+	Title      string `json:"title"`
+	Depth      int    `json:"depth"`
+	StatusCode int    `json:"statusCode"`
+}
+
+// Monitor receives updates as a crawl progresses.
+type Monitor interface {
+	Visited(page *PageEvent)
+	Skipped(url string, reason string)
+	Failed(url string, err error)
+	Queued(depth int)
+	Limited(limit string)
+}
+
+type nullMonitor struct{}
+
+func (nullMonitor) Visited(page *PageEvent)           {}
+func (nullMonitor) Skipped(url string, reason string) {}
+func (nullMonitor) Failed(url string, err error)      {}
+func (nullMonitor) Queued(depth int)                  {}
+func (nullMonitor) Limited(limit string)              {}
+
+// Crawl walks the site starting at the root url and returns a proposition for
+// every page reached within the limits in the options, along with the links
+// found between them. Pages are identified by their canonical url, with the
+// other urls that led to the same page kept as its aliases. The crawl stops
+// early if the context is cancelled, in which case the pages found so far are
+// returned with the context error.
+func Crawl(ctx context.Context, root *url.URL, options Options, monitor Monitor) (*Result, error) {
+	log.Infof("crawling site '%s'", root.String())
+	if monitor == nil {
+		monitor = nullMonitor{}
+	}
+	if options.Parallelism < 1 {
+		options.Parallelism = 1
+	}
+	if options.Canonical == nil {
+		options.Canonical = DefaultCanonicalRules()
+	}
+	if options.Titles == nil {
+		options.Titles = DefaultTitleRules()
+	}
+
+	transport := options.Pages.transport(newTransport(options))
+	c := &crawler{
+		ctx:       ctx,
+		root:      root,
+		options:   options,
+		monitor:   monitor,
+		transport: transport,
+		client: &http.Client{
+			Timeout:       fetchTimeout,
+			Transport:     transport,
+			CheckRedirect: checkRedirect(root, options),
+		},
+		limits:       newLimiter(options),
+		enqueued:     map[string]bool{},
+		visited:      map[string]bool{},
+		moved:        map[string]string{},
+		aliases:      map[string]map[string]bool{},
+		propositions: []*Proposition{},
+		links:        []*Link{},
+		lock:         &sync.Mutex{},
+	}
+
+	// robots.txt is also where sites list their sitemaps
+	if options.RespectRobots || options.Sitemap != SitemapNone {
+		var err error
+		c.robots, err = loadRobots(c.client, root, options.UserAgent)
+		if err != nil {
+			log.Warnf("ignoring robots.txt for site '%s': %v", root.String(), err)
+		}
+	}
+
+	var sitemapURLs []string
+	if options.Sitemap != SitemapNone {
+		sitemapURLs = loadSitemaps(c.client, root, c.robots, options)
+	}
+	if options.Sitemap == SitemapOnly {
+		c.propositions = c.fromSitemap(sitemapURLs)
+		return c.result(), nil
+	}
+
+	err := c.init()
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.enqueue(root, "", "", 0) {
+		return c.result(), nil
+	}
+	// seeded pages hang off their nearest ancestor in the sitemap until the
+	// crawl finds links to them
+	seedURLs := append(c.startURLs(), sitemapURLs...)
+	seeds := c.sitemapSet(seedURLs)
+	for _, s := range seedURLs {
+		seedParsed, err := url.Parse(s)
+		if err != nil || seedParsed.Hostname() != root.Hostname() {
+			continue
+		}
+		c.enqueue(seedParsed, pathParent(c.canonical(seedParsed), seeds, c.canonical(root).String()), "", 1)
+	}
+
+	err = c.queue.Run(c.collector)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to run crawl queue")
+	}
+	if err := c.fetchError(); err != nil {
+		return nil, err
+	}
+
+	if unchanged := transport.unchangedPages(); unchanged > 0 {
+		log.Infof("crawl of site '%s' reused %d unchanged pages", root.String(), unchanged)
+	}
+	options.Pages.prune()
+	if limit := c.limits.reached(); limit != "" {
+		log.Infof("crawl of site '%s' ended by %s limit", root.String(), limit)
+		monitor.Limited(limit)
+	}
+
+	if ctx.Err() != nil {
+		return c.result(), ctx.Err()
+	}
+
+	return c.result(), nil
+}
+
+// startURLs resolves the start urls against the root.
+func (c *crawler) startURLs() []string {
+	urls := []string{}
+	for _, s := range c.options.StartURLs {
+		start, err := c.root.Parse(s)
+		if err != nil {
+			log.Warnf("ignoring start url '%s': %v", s, err)
+			continue
+		}
+		urls = append(urls, start.String())
+	}
+
+	return urls
+}
+
+// FetchError is returned when the root page of a site cannot be fetched, so
+// nothing could be crawled.
+type FetchError struct {
+	URL string
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("unable to fetch '%s': %v", e.URL, e.Err)
+}
+
+// Unwrap returns the error fetching the root page.
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// fetchError returns the error fetching the root page when no page could be
+// crawled.
+func (c *crawler) fetchError() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.rootErr == nil || len(c.visited) > 0 {
+		return nil
+	}
+
+	return &FetchError{URL: c.root.String(), Err: c.rootErr}
+}
+
+// crawler holds the state of a single crawl.
+type crawler struct {
+	ctx          context.Context
+	root         *url.URL
+	options      Options
+	monitor      Monitor
+	transport    *revalidatingTransport
+	client       *http.Client
+	robots       *robots
+	limits       *limiter
+	collector    *colly.Collector
+	queue        *queue.Queue
+	enqueued     map[string]bool
+	visited      map[string]bool
+	moved        map[string]string
+	aliases      map[string]map[string]bool
+	propositions []*Proposition
+	links        []*Link
+	rootErr      error
+	lock         *sync.Mutex
+}
+
+// result gathers the crawled pages, pointing any links to a page that moved
+// at the page it ended up as, attaching the aliases of each page and cleaning
+// the site branding from the tags.
+func (c *crawler) result() *Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	aliases := map[string]map[string]bool{}
+	addAliases := func(page string, urls ...string) {
+		if aliases[page] == nil {
+			aliases[page] = map[string]bool{}
+		}
+		for _, u := range urls {
+			if u != page {
+				aliases[page][u] = true
+			}
+		}
+	}
+	for key := range c.moved {
+		addAliases(c.resolve(key), key)
+	}
+	for key, urls := range c.aliases {
+		page := c.resolve(key)
+		addAliases(page, key)
+		for u := range urls {
+			addAliases(page, u)
+		}
+	}
+
+	for _, p := range c.propositions {
+		if len(aliases[p.URL]) == 0 {
+			continue
+		}
+		p.Aliases = []string{}
+		for u := range aliases[p.URL] {
+			p.Aliases = append(p.Aliases, u)
+		}
+		sort.Strings(p.Aliases)
+	}
+	c.options.Titles.normalise(c.propositions)
+
+	links := make([]*Link, len(c.links))
+	for i, l := range c.links {
+		link := *l
+		link.Target = c.resolve(l.Target)
+		links[i] = &link
+	}
+
+	return &Result{
+		Propositions: c.propositions,
+		Links:        links,
+	}
+}
+
+// resolve follows the moves of a canonical url to the page it ended up as.
+func (c *crawler) resolve(key string) string {
+	for i := 0; i < len(c.moved); i++ {
+		page, ok := c.moved[key]
+		if !ok {
+			break
+		}
+		key = page
+	}
+
+	return key
+}
+
+func (c *crawler) canonical(page *url.URL) *url.URL {
+	return c.options.Canonical.Canonicalise(page)
+}
+
+// addAlias records a url that was found to be the page with the canonical url.
+// It must be called with the lock held.
+func (c *crawler) addAlias(key string, alias string) {
+	if alias == key {
+		return
+	}
+	if c.aliases[key] == nil {
+		c.aliases[key] = map[string]bool{}
+	}
+	c.aliases[key][alias] = true
+}
+
+// pageURL returns the canonical url of a fetched page, which depends on where
+// any redirects ended and on the page's own canonical link.
+func (c *crawler) pageURL(r *colly.Response, doc *goquery.Document) string {
+	page := r.Ctx.Get("key")
+	if c.options.Canonical.FollowRedirects {
+		page = c.canonical(r.Request.URL).String()
+	}
+	if c.options.Canonical.CanonicalTag {
+		if tag := canonicalTag(r.Request.URL, doc); tag != nil {
+			page = c.canonical(tag).String()
+		}
+	}
+
+	return page
+}
+
+func (c *crawler) init() error {
+	// redirects to hosts the crawl may not fetch are refused by the redirect
+	// handler, which records them as blocked
+	c.collector = colly.NewCollector(
+		colly.UserAgent(c.options.UserAgent),
+	)
+	c.collector.WithTransport(c.transport)
+	c.collector.SetRedirectHandler(checkRedirect(c.root, c.options))
+
+	delay := c.options.Delay
+	if c.options.RespectRobots && c.robots != nil && c.robots.crawlDelay() > delay {
+		delay = c.robots.crawlDelay()
+	}
+	err := c.collector.Limit(&colly.LimitRule{
+		DomainGlob:  "*",
+		Parallelism: c.options.Parallelism,
+		Delay:       delay,
+		RandomDelay: c.options.RandomDelay,
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to set crawl rate limit")
+	}
+
+	c.queue, err = queue.New(c.options.Parallelism, &queue.InMemoryQueueStorage{MaxSize: 10000})
+	if err != nil {
+		return errors.Wrap(err, "unable to create crawl queue")
+	}
+
+	c.collector.OnRequest(func(r *colly.Request) {
+		if c.ctx.Err() != nil || !c.limits.allowFetch() {
+			r.Abort()
+		}
+	})
+
+	// Find and queue all links
+	c.collector.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		if c.ctx.Err() != nil || e.Request.Ctx.Get("duplicate") != "" {
+			return
+		}
+
+		link := e.Request.AbsoluteURL(e.Attr("href"))
+		linkParsed, err := url.Parse(link)
+		if link == "" || err != nil || linkParsed.Hostname() != c.root.Hostname() {
+			return
+		}
+		page := e.Request.Ctx.Get("page")
+		anchor := newLink(e, page, c.canonical(linkParsed).String())
+		c.addLink(anchor)
+		c.enqueue(linkParsed, page, anchor.Text, e.Request.Depth+1)
+	})
+
+	c.collector.OnResponse(func(r *colly.Response) {
+		c.limits.downloaded(len(r.Body))
+
+		// a page reached through a redirect or naming its canonical url may
+		// already have been crawled under that url
+		doc := parseDocument(r)
+		key := r.Ctx.Get("key")
+		page := c.pageURL(r, doc)
+		r.Ctx.Put("page", page)
+		c.lock.Lock()
+		if page != key {
+			c.moved[key] = page
+		}
+		if c.visited[page] {
+			c.lock.Unlock()
+			r.Ctx.Put("duplicate", "true")
+			c.monitor.Skipped(key, skipDuplicate)
+			return
+		}
+		c.visited[page] = true
+		c.enqueued[page] = true
+		c.lock.Unlock()
+
+		prop := c.newProposition(r, doc, page)
+		c.lock.Lock()
+		c.propositions = append(c.propositions, prop)
+		c.lock.Unlock()
+		c.monitor.Visited(&PageEvent{
+			URL:        prop.URL,
+			ParentURL:  prop.ParentURL,
+			Title:      prop.Tag,
+			Depth:      r.Request.Depth,
+			StatusCode: r.StatusCode,
+		})
+		c.monitor.Queued(queueSize(c.queue))
+	})
+
+	c.collector.OnError(func(r *colly.Response, err error) {
+		if r.Request.Depth == 0 {
+			c.lock.Lock()
+			c.rootErr = err
+			c.lock.Unlock()
+		}
+		if blocked, ok := blockedError(err); ok {
+			log.Warnf("crawl of site '%s' %v", c.root.String(), blocked)
+			c.monitor.Skipped(r.Request.URL.String(), fmt.Sprintf("%s: %s", skipBlocked, blocked.Reason))
+			return
+		}
+		c.monitor.Failed(r.Request.URL.String(), err)
+	})
+
+	return nil
+}
+
+// addLink records a link between two pages.
+func (c *crawler) addLink(link *Link) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.links = append(c.links, link)
+}
+
+// enqueue adds the page to the crawl queue unless its canonical url was
+// already queued or it is excluded by robots.txt or the crawl limits. The
+// anchor is the text of the link the page was found through.
+func (c *crawler) enqueue(page *url.URL, parent string, anchor string, depth int) bool {
+	link := c.canonical(page).String()
+
+	c.lock.Lock()
+	c.addAlias(link, page.String())
+	if c.enqueued[link] {
+		c.lock.Unlock()
+		return false
+	}
+	if c.options.RespectRobots && c.robots != nil && !c.robots.allowed(page) {
+		c.enqueued[link] = true
+		c.lock.Unlock()
+		c.monitor.Skipped(link, skipRobots)
+		return false
+	}
+	// links over a limit are not marked as queued since the depth limit
+	// may allow the same link when it is found closer to the root
+	if !c.limits.allowPage(depth) {
+		c.lock.Unlock()
+		return false
+	}
+	c.enqueued[link] = true
+	c.lock.Unlock()
+
+	// the page is fetched as linked since the canonical url is not always
+	// served, such as when the trailing slash is trimmed
+	fetch := *page
+	fetch.Fragment = ""
+	linkCtx := colly.NewContext()
+	linkCtx.Put("parent", parent)
+	linkCtx.Put("link", anchor)
+	linkCtx.Put("key", link)
+	err := c.queue.AddRequest(&colly.Request{
+		URL:    &fetch,
+		Method: "GET",
+		Depth:  depth,
+		Ctx:    linkCtx,
+	})
+	if err != nil {
+		c.monitor.Failed(link, errors.Wrap(err, "unable to queue link"))
+		return false
+	}
+	c.monitor.Queued(queueSize(c.queue))
+
+	return true
+}
+
+func queueSize(q *queue.Queue) int {
+	size, _ := q.Size()
+	return size
+}
+
+// parseDocument parses the body of an HTML response, returning nil for any
+// other content.
+func parseDocument(r *colly.Response) *goquery.Document {
+	if !strings.Contains(strings.ToLower(r.Headers.Get("Content-Type")), "html") {
+		return nil
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(r.Body))
+	if err != nil {
+		return nil
+	}
+
+	return doc
+}
+
+func (c *crawler) newProposition(r *colly.Response, doc *goquery.Document, page string) *Proposition {
+	tag, potentialTags := labelPage(doc, r.Ctx.Get("link"), page, c.options)
+	return &Proposition{
+		ID:            c.options.propositionID(page),
+		Tag:           tag,
+		PotentialTags: potentialTags,
+		URL:           page,
+		Key:           page,
+		ParentURL:     r.Ctx.Get("parent"),
+		Breadcrumb:    c.resolveBreadcrumb(extractBreadcrumb(doc), r.Request.URL),
+	}
+}
+
+func createID() (string, error) {
+	uuid, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+
+	return uuid.String(), nil
+}
@@ -0,0 +1,144 @@
+package crawl
+
+import (
+	"sort"
+)
+
+const (
+	// ChangeAdded is a page found only in the later crawl.
+	ChangeAdded = "added"
+	// ChangeRemoved is a page found only in the earlier crawl.
+	ChangeRemoved = "removed"
+	// ChangeMoved is a page whose parent changed between the crawls.
+	ChangeMoved = "moved"
+	// ChangeRenamed is a page whose tag changed between the crawls.
+	ChangeRenamed = "renamed"
+)
+
+// Change is a proposition that differs between two crawls of a site.
+type Change struct {
+	Change string `json:"change"`
+	// Proposition is the page in the later crawl, or in the earlier crawl
+	// when it was removed.
+	Proposition *Proposition `json:"proposition"`
+	// Previous is the page in the earlier crawl of a moved or renamed page.
+	Previous          *Proposition `json:"previous,omitempty"`
+	ParentURL         string       `json:"parentUrl,omitempty"`
+	PreviousParentURL string       `json:"previousParentUrl,omitempty"`
+}
+
+// GraphDiff lists the propositions that changed between two crawls. A page
+// that was both moved and renamed is listed as both.
+type GraphDiff struct {
+	Before  *Metadata `json:"before,omitempty"`
+	After   *Metadata `json:"after,omitempty"`
+	Added   []*Change `json:"added"`
+	Removed []*Change `json:"removed"`
+	Moved   []*Change `json:"moved"`
+	Renamed []*Change `json:"renamed"`
+}
+
+// Changes returns every change, grouped by kind.
+func (d *GraphDiff) Changes() []*Change {
+	changes := []*Change{}
+	changes = append(changes, d.Added...)
+	changes = append(changes, d.Removed...)
+	changes = append(changes, d.Moved...)
+	changes = append(changes, d.Renamed...)
+
+	return changes
+}
+
+// DiffGraphs compares two graphs of a site, matching pages by url. Each list
+// of changes is sorted by url.
+func DiffGraphs(before *Graph, after *Graph) *GraphDiff {
+	beforePages := graphPages(before)
+	afterPages := graphPages(after)
+
+	diff := &GraphDiff{
+		Added:   []*Change{},
+		Removed: []*Change{},
+		Moved:   []*Change{},
+		Renamed: []*Change{},
+	}
+	for key, page := range afterPages {
+		previous, ok := beforePages[key]
+		if !ok {
+			diff.Added = append(diff.Added, &Change{
+				Change:      ChangeAdded,
+				Proposition: page.node.Data,
+				ParentURL:   page.parent,
+			})
+			continue
+		}
+		if page.parent != previous.parent {
+			diff.Moved = append(diff.Moved, &Change{
+				Change:            ChangeMoved,
+				Proposition:       page.node.Data,
+				Previous:          previous.node.Data,
+				ParentURL:         page.parent,
+				PreviousParentURL: previous.parent,
+			})
+		}
+		if page.node.Data.Tag != previous.node.Data.Tag {
+			diff.Renamed = append(diff.Renamed, &Change{
+				Change:            ChangeRenamed,
+				Proposition:       page.node.Data,
+				Previous:          previous.node.Data,
+				ParentURL:         page.parent,
+				PreviousParentURL: previous.parent,
+			})
+		}
+	}
+	for key, previous := range beforePages {
+		if _, ok := afterPages[key]; !ok {
+			diff.Removed = append(diff.Removed, &Change{
+				Change:            ChangeRemoved,
+				Proposition:       previous.node.Data,
+				PreviousParentURL: previous.parent,
+			})
+		}
+	}
+
+	for _, changes := range [][]*Change{diff.Added, diff.Removed, diff.Moved, diff.Renamed} {
+		sortChanges(changes)
+	}
+
+	return diff
+}
+
+type graphPage struct {
+	node   *Node
+	parent string
+}
+
+// graphPages returns every page of the graph keyed by url, along with the url
+// of its parent in the graph.
+func graphPages(graph *Graph) map[string]*graphPage {
+	pages := map[string]*graphPage{}
+	if graph == nil || graph.Root == nil {
+		return pages
+	}
+
+	var walk func(node *Node, parent string)
+	walk = func(node *Node, parent string) {
+		if node.Key != "" {
+			if _, ok := pages[node.Key]; ok {
+				return
+			}
+			pages[node.Key] = &graphPage{node, parent}
+		}
+		for _, child := range node.Neighbours {
+			walk(child, node.Key)
+		}
+	}
+	walk(graph.Root, "")
+
+	return pages
+}
+
+func sortChanges(changes []*Change) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Proposition.URL < changes[j].Proposition.URL
+	})
+}
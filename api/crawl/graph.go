@@ -0,0 +1,114 @@
+package crawl
+
+// Graph is a collection of nodes with a single root.
+type Graph struct {
+	URL  string `json:"url"`
+	Root *Node  `json:"root"`
+}
+
+// FullNameSeparator follows each name in a proposition full name.
+const FullNameSeparator = "/"
+
+// Node is one entity in a graph.
+type Node struct {
+	Key        string       `json:"key"`
+	Neighbours []*Node      `json:"neighbours"`
+	Data       *Proposition `json:"data"`
+}
+
+// Proposition is an entity being extracted from a site.
+type Proposition struct {
+	ID            string   `json:"id"`
+	FullName      string   `json:"fullname"`
+	Tag           string   `json:"tag"`
+	Code          string   `json:"code"`
+	URL           string   `json:"url"`
+	Key           string   `json:"key"`
+	PotentialTags []string `json:"potentialTags"`
+	ParentURL     string   `json:"parentUrl"`
+	Aliases       []string `json:"aliases,omitempty"`
+	Breadcrumb    []*Crumb `json:"breadcrumb,omitempty"`
+}
+
+// Link is a hyperlink from one page to another. Every anchor is kept, so two
+// pages can be joined by more than one link.
+type Link struct {
+	Source   string   `json:"source"`
+	Target   string   `json:"target"`
+	Text     string   `json:"text,omitempty"`
+	Rel      []string `json:"rel,omitempty"`
+	Position string   `json:"position,omitempty"`
+	Index    int      `json:"index"`
+}
+
+// ToPropertySlice converts a proposition to a string slice.
+func (p *Proposition) ToPropertySlice() []string {
+	return []string{
+		p.ID,
+		p.FullName,
+		p.Tag,
+		p.Code,
+		p.URL,
+	}
+}
+
+// Clone returns a copy of the proposition that can be modified without
+// affecting the original.
+func (p *Proposition) Clone() *Proposition {
+	clone := *p
+	clone.PotentialTags = append([]string{}, p.PotentialTags...)
+	if p.Aliases != nil {
+		clone.Aliases = append([]string{}, p.Aliases...)
+	}
+	if p.Breadcrumb != nil {
+		clone.Breadcrumb = append([]*Crumb{}, p.Breadcrumb...)
+	}
+	return &clone
+}
+
+// BuildNodes links the propositions into nodes keyed by URL. The propositions
+// are copied so the same crawl result can be processed more than once.
+func BuildNodes(propositions []*Proposition) map[string]*Node {
+	nodes := map[string]*Node{}
+	for _, p := range propositions {
+		nodes = AddNode(nodes, p.Clone())
+	}
+
+	return nodes
+}
+
+// AddNode adds the proposition to the nodes, attaching it to its parent. A
+// proposition with no known parent is attached to the empty root node.
+func AddNode(nodes map[string]*Node, proposition *Proposition) map[string]*Node {
+	newNode := &Node{
+		Key:        proposition.URL,
+		Neighbours: []*Node{},
+		Data:       proposition,
+	}
+	nodes[newNode.Key] = newNode
+	parentNode := nodes[newNode.Data.ParentURL]
+	if parentNode == nil {
+		parentNode = nodes[""]
+	}
+	if parentNode == nil {
+		parentNode = &Node{
+			Key:        "",
+			Neighbours: []*Node{},
+			Data:       &Proposition{},
+		}
+		nodes[parentNode.Key] = parentNode
+	}
+	parentNode.Neighbours = append(parentNode.Neighbours, newNode)
+
+	return nodes
+}
+
+// AssignFullNames sets the full name of every proposition below the node to
+// the full name of the node followed by the names of the pages on the path
+// down to it, each followed by the separator.
+func AssignFullNames(node *Node, separator string) {
+	for _, child := range node.Neighbours {
+		child.Data.FullName = node.Data.FullName + child.Data.Name() + separator
+		AssignFullNames(child, separator)
+	}
+}
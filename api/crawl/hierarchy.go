@@ -0,0 +1,324 @@
+package crawl
+
+import (
+	"net/url"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// HierarchyBreadcrumb makes each page a child of the last crumb above it
+	// in the breadcrumb it publishes, adding the crumbs that were not crawled
+	// as pages of their own. Pages without a breadcrumb keep the page they were
+	// discovered from.
+	HierarchyBreadcrumb = "breadcrumb"
+	// HierarchyDiscovery makes each page a child of the page it was first
+	// discovered from during the crawl.
+	HierarchyDiscovery = "discovery"
+	// HierarchyURLPath makes each page a child of the nearest crawled page
+	// whose url path is an ancestor of its own.
+	HierarchyURLPath = "url-path"
+	// HierarchyShortestPath makes each page a child of the page before it on
+	// the shortest link path from the root.
+	HierarchyShortestPath = "shortest-path"
+)
+
+var (
+	// Hierarchies lists the strategies for choosing each page parent.
+	Hierarchies = []string{HierarchyBreadcrumb, HierarchyDiscovery, HierarchyURLPath, HierarchyShortestPath}
+)
+
+// Nodes links the propositions into graph nodes, choosing each parent using
+// the hierarchy strategy. Without a strategy the breadcrumbs published by the
+// site are used when there are any. The result itself is left unchanged.
+func (r *Result) Nodes(hierarchy string) (map[string]*Node, error) {
+	if len(r.Propositions) == 0 {
+		return BuildNodes(r.Propositions), nil
+	}
+
+	// the first page without a parent is the root the crawl started from
+	root := r.Propositions[0]
+	for _, p := range r.Propositions {
+		if p.ParentURL == "" {
+			root = p
+			break
+		}
+	}
+
+	if hierarchy == "" {
+		hierarchy = HierarchyDiscovery
+		for _, p := range r.Propositions {
+			if len(p.Breadcrumb) > 0 {
+				hierarchy = HierarchyBreadcrumb
+				break
+			}
+		}
+	}
+
+	var propositions []*Proposition
+	switch hierarchy {
+	case HierarchyBreadcrumb:
+		propositions = breadcrumbHierarchy(root, r.Propositions)
+	case HierarchyDiscovery:
+		propositions = discoveryHierarchy(root, r.Propositions)
+	case HierarchyURLPath:
+		propositions = urlPathHierarchy(root, r.Propositions)
+	case HierarchyShortestPath:
+		propositions = shortestPathHierarchy(root, r.Propositions, r.Links)
+	default:
+		return nil, errors.Errorf("unknown hierarchy '%s'", hierarchy)
+	}
+
+	nodes := BuildNodes(propositions)
+	if r.Metadata != nil && r.Metadata.IDs == IDPath {
+		AssignPathIDs(nodes)
+	}
+
+	return nodes, nil
+}
+
+// Graph arranges the result into a graph using the hierarchy strategy, with
+// codes and full names assigned. The root of the graph is the empty node above
+// the site root.
+func (r *Result) Graph(hierarchy string, codes CodeOptions) (*Graph, error) {
+	nodes, err := r.Nodes(hierarchy)
+	if err != nil {
+		return nil, err
+	}
+
+	err = AssignCodes(nodes, codes)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &Graph{
+		Root: nodes[""],
+	}
+	if r.Metadata != nil {
+		graph.URL = r.Metadata.URL
+	}
+	if graph.Root != nil {
+		graph.Root.Data.FullName = FullNameSeparator
+		AssignFullNames(graph.Root, FullNameSeparator)
+	}
+
+	return graph, nil
+}
+
+// discoveryHierarchy keeps the page each proposition was discovered from.
+// Sitemap seeds are crawled in parallel with a parent taken from their path, so
+// a seed can be visited before its parent, or its parent never be crawled at
+// all: those pages move to their nearest crawled path ancestor, and every page
+// is ordered after its parent.
+func discoveryHierarchy(root *Proposition, propositions []*Proposition) []*Proposition {
+	known := map[string]bool{}
+	for _, p := range propositions {
+		known[p.URL] = true
+	}
+
+	reparented := []*Proposition{}
+	for _, p := range propositions {
+		clone := p.Clone()
+		if p != root && !known[p.ParentURL] {
+			page, err := url.Parse(p.URL)
+			if err != nil {
+				clone.ParentURL = root.URL
+			} else {
+				clone.ParentURL = pathParent(page, known, root.URL)
+			}
+		}
+		reparented = append(reparented, clone)
+	}
+
+	return parentsFirst(root, reparented)
+}
+
+func urlPathHierarchy(root *Proposition, propositions []*Proposition) []*Proposition {
+	known := map[string]bool{}
+	for _, p := range propositions {
+		known[p.URL] = true
+	}
+
+	type pathProposition struct {
+		proposition *Proposition
+		depth       int
+	}
+	reparented := []*pathProposition{}
+	for _, p := range propositions {
+		clone := p.Clone()
+		depth := 0
+		if p != root {
+			page, err := url.Parse(p.URL)
+			if err != nil {
+				clone.ParentURL = root.URL
+			} else {
+				clone.ParentURL = pathParent(page, known, root.URL)
+				depth = pathDepth(page) + 1
+			}
+		}
+		reparented = append(reparented, &pathProposition{clone, depth})
+	}
+
+	// parents have shorter paths so sorting by depth adds them first, keeping
+	// the crawl order within each depth
+	sort.SliceStable(reparented, func(i, j int) bool {
+		return reparented[i].depth < reparented[j].depth
+	})
+	sorted := make([]*Proposition, len(reparented))
+	for i, p := range reparented {
+		sorted[i] = p.proposition
+	}
+
+	return sorted
+}
+
+func shortestPathHierarchy(root *Proposition, propositions []*Proposition, links []*Link) []*Proposition {
+	byURL := map[string]*Proposition{}
+	for _, p := range propositions {
+		byURL[p.URL] = p
+	}
+	outgoing := map[string][]string{}
+	for _, l := range links {
+		outgoing[l.Source] = append(outgoing[l.Source], l.Target)
+	}
+
+	// breadth first search from the root, in crawl link order
+	rootClone := root.Clone()
+	sorted := []*Proposition{rootClone}
+	visited := map[string]bool{root.URL: true}
+	frontier := []string{root.URL}
+	for len(frontier) > 0 {
+		current := frontier[0]
+		frontier = frontier[1:]
+		for _, target := range outgoing[current] {
+			p, ok := byURL[target]
+			if !ok || visited[target] {
+				continue
+			}
+			visited[target] = true
+			clone := p.Clone()
+			clone.ParentURL = current
+			sorted = append(sorted, clone)
+			frontier = append(frontier, target)
+		}
+	}
+
+	// pages not reachable through the links, such as sitemap seeds, hang off
+	// the root
+	for _, p := range propositions {
+		if visited[p.URL] {
+			continue
+		}
+		clone := p.Clone()
+		clone.ParentURL = root.URL
+		sorted = append(sorted, clone)
+	}
+
+	return sorted
+}
+
+func breadcrumbHierarchy(root *Proposition, propositions []*Proposition) []*Proposition {
+	known := map[string]*Proposition{}
+	reparented := []*Proposition{}
+	for _, p := range propositions {
+		clone := p.Clone()
+		known[clone.URL] = clone
+		reparented = append(reparented, clone)
+	}
+
+	// crawled pages named in another page's trail without a breadcrumb of
+	// their own take their place and name from the first trail naming them
+	placed := map[string]bool{root.URL: true}
+	for _, p := range reparented {
+		if len(p.trail()) > 0 {
+			placed[p.URL] = true
+		}
+	}
+
+	for _, p := range reparented[:len(propositions)] {
+		trail := p.trail()
+		if p.URL == root.URL || len(trail) == 0 {
+			continue
+		}
+
+		parentURL := root.URL
+		for i, crumb := range trail {
+			// trails start at the home page even when it is not linked, and
+			// other crumbs without a link are keyed under the crumb above them
+			key := crumb.URL
+			if key == "" && i == 0 {
+				key = root.URL
+			} else if key == "" {
+				key = parentURL + "#" + crumb.Name
+			}
+			if key == p.URL {
+				continue
+			}
+			if existing, ok := known[key]; ok {
+				if !placed[key] {
+					existing.ParentURL = parentURL
+					existing.Breadcrumb = append([]*Crumb{}, trail[:i+1]...)
+					placed[key] = true
+				}
+			} else {
+				// crumb pages are added on every render of the result, so
+				// they take url ids even under the random strategy to keep
+				// the same id in every view of a stored crawl
+				crumbPage := &Proposition{
+					ID:            URLID(key),
+					Tag:           crumb.Name,
+					PotentialTags: []string{crumb.Name},
+					URL:           key,
+					Key:           key,
+					ParentURL:     parentURL,
+				}
+				known[key] = crumbPage
+				placed[key] = true
+				reparented = append(reparented, crumbPage)
+			}
+			parentURL = key
+		}
+		p.ParentURL = parentURL
+	}
+
+	return parentsFirst(root, reparented)
+}
+
+// parentsFirst orders the propositions so each one follows its parent. Pages
+// whose parents loop back on themselves or are missing are moved under the
+// root.
+func parentsFirst(root *Proposition, propositions []*Proposition) []*Proposition {
+	children := map[string][]*Proposition{}
+	var rootClone *Proposition
+	for _, p := range propositions {
+		if p.URL == root.URL {
+			rootClone = p
+			continue
+		}
+		children[p.ParentURL] = append(children[p.ParentURL], p)
+	}
+
+	sorted := []*Proposition{}
+	placed := map[string]bool{}
+	var place func(p *Proposition)
+	place = func(p *Proposition) {
+		if placed[p.URL] {
+			return
+		}
+		placed[p.URL] = true
+		sorted = append(sorted, p)
+		for _, c := range children[p.URL] {
+			place(c)
+		}
+	}
+	place(rootClone)
+	for _, p := range propositions {
+		if !placed[p.URL] {
+			p.ParentURL = root.URL
+			place(p)
+		}
+	}
+
+	return sorted
+}
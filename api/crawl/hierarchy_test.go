@@ -0,0 +1,94 @@
+package crawl
+
+import (
+	"testing"
+)
+
+func TestDiscoveryHierarchy(t *testing.T) {
+	root := &Proposition{URL: "http://example.com/"}
+	propositions := []*Proposition{
+		root,
+		// visited before its parent by a parallel crawl of sitemap seeds
+		{URL: "http://example.com/a/b", ParentURL: "http://example.com/a"},
+		{URL: "http://example.com/a", ParentURL: "http://example.com/"},
+		// its path parent was never crawled
+		{URL: "http://example.com/c/d/e", ParentURL: "http://example.com/c/d"},
+		{URL: "http://example.com/a/b/c/d", ParentURL: "http://example.com/a/b/c"},
+		{URL: "http://example.com/f", ParentURL: "http://example.com/a/b"},
+	}
+
+	sorted := discoveryHierarchy(root, propositions)
+	if len(sorted) != len(propositions) {
+		t.Fatalf("got %d propositions, want %d", len(sorted), len(propositions))
+	}
+	parents := map[string]string{}
+	for _, p := range sorted {
+		if p.URL != root.URL {
+			if _, ok := parents[p.ParentURL]; !ok {
+				t.Errorf("'%s' comes before its parent '%s'", p.URL, p.ParentURL)
+			}
+		}
+		parents[p.URL] = p.ParentURL
+	}
+
+	want := map[string]string{
+		"http://example.com/a/b":     "http://example.com/a",
+		"http://example.com/a":       "http://example.com/",
+		"http://example.com/c/d/e":   "http://example.com/",
+		"http://example.com/a/b/c/d": "http://example.com/a/b",
+		"http://example.com/f":       "http://example.com/a/b",
+	}
+	for url, parent := range want {
+		if parents[url] != parent {
+			t.Errorf("'%s' has parent '%s', want '%s'", url, parents[url], parent)
+		}
+	}
+	if propositions[1].ParentURL != "http://example.com/a" || propositions[3].ParentURL != "http://example.com/c/d" {
+		t.Error("the result propositions were changed")
+	}
+}
+
+func TestBreadcrumbHierarchyIDs(t *testing.T) {
+	shop := "http://example.com/shop"
+	for _, ids := range IDStrategies {
+		t.Run(ids, func(t *testing.T) {
+			result := &Result{
+				Metadata: &Metadata{IDs: ids},
+				Propositions: []*Proposition{
+					{ID: "root", URL: "http://example.com/", Key: "http://example.com/"},
+					{
+						ID:  "page",
+						URL: "http://example.com/shop/page",
+						Key: "http://example.com/shop/page",
+						Breadcrumb: []*Crumb{
+							{Name: "Home", URL: "http://example.com/"},
+							{Name: "Shop", URL: shop},
+							{Name: "Page"},
+						},
+						ParentURL: "http://example.com/",
+					},
+				},
+			}
+
+			// every render of the stored result gives the crumb page the same id
+			renders := []string{}
+			for i := 0; i < 2; i++ {
+				nodes, err := result.Nodes(HierarchyBreadcrumb)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				node, ok := nodes[shop]
+				if !ok {
+					t.Fatalf("crumb page '%s' was not added", shop)
+				}
+				renders = append(renders, node.Data.ID)
+			}
+			if renders[0] != renders[1] {
+				t.Errorf("crumb page got ids '%s' and '%s' from two renders", renders[0], renders[1])
+			}
+			if got := renders[0]; (got == URLID(shop)) != (ids != IDPath) {
+				t.Errorf("crumb page got id '%s' for the %s strategy", got, ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package crawl
+
+import (
+	"net/url"
+
+	uuid "github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// IDURL derives each proposition id from its canonical url, so a page
+	// keeps its id across crawls.
+	IDURL = "url"
+	// IDPath derives each proposition id from the urls of the pages above it
+	// in the hierarchy, so a page moved in the hierarchy gets a new id.
+	IDPath = "path"
+	// IDRandom gives each crawled proposition a new random id on every
+	// crawl. Breadcrumb pages that were not crawled keep url ids.
+	IDRandom = "random"
+)
+
+var (
+	// IDStrategies lists the strategies for generating proposition ids.
+	IDStrategies = []string{IDURL, IDPath, IDRandom}
+)
+
+func validateIDs(ids string) error {
+	if ids == "" || containsString(IDStrategies, ids) {
+		return nil
+	}
+
+	return errors.Errorf("unknown proposition id strategy '%s'", ids)
+}
+
+// propositionID returns the id of the page as set by the options. Path ids
+// depend on the hierarchy so pages are given url ids until AssignPathIDs is
+// run on the graph.
+func (o *Options) propositionID(page string) string {
+	if o.IDs == IDRandom {
+		id, _ := createID()
+		return id
+	}
+
+	return URLID(page)
+}
+
+// URLID returns a version 5 uuid of the url in the namespace of its site.
+func URLID(page string) string {
+	return uuid.NewV5(siteNamespace(page), page).String()
+}
+
+// siteNamespace returns the uuid namespace holding the ids of the pages of the
+// site the url belongs to.
+func siteNamespace(page string) uuid.UUID {
+	site := page
+	if parsed, err := url.Parse(page); err == nil {
+		site = (&url.URL{Scheme: parsed.Scheme, Host: parsed.Host}).String()
+	}
+
+	return uuid.NewV5(uuid.NamespaceURL, site)
+}
+
+// AssignPathIDs sets the id of every proposition in the nodes from the urls
+// of the pages on the path down to it from the empty root.
+func AssignPathIDs(nodes map[string]*Node) {
+	root := nodes[""]
+	if root == nil {
+		return
+	}
+
+	var assign func(node *Node, path string)
+	assign = func(node *Node, path string) {
+		for _, child := range node.Neighbours {
+			childPath := path + "\n" + child.Key
+			child.Data.ID = uuid.NewV5(siteNamespace(child.Key), childPath).String()
+			assign(child, childPath)
+		}
+	}
+	assign(root, "")
+}
@@ -0,0 +1,460 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/unchartedsoftware/plog"
+
+	"github.com/phorne-uncharted/proposition-poc/api/quota"
+)
+
+// JobStatus is the lifecycle state of a crawl job.
+type JobStatus string
+
+const (
+	// JobRunning is a job that is still crawling.
+	JobRunning JobStatus = "running"
+	// JobCompleted is a job that crawled the whole site.
+	JobCompleted JobStatus = "completed"
+	// JobCancelled is a job that was stopped before it finished.
+	JobCancelled JobStatus = "cancelled"
+	// JobFailed is a job that stopped because of an error.
+	JobFailed JobStatus = "failed"
+	// JobTimedOut is a job that ran past the deadline of its context.
+	JobTimedOut JobStatus = "timedOut"
+
+	subscriberBufferSize = 1024
+
+	// defaultJobTTL is how long finished jobs are kept unless set otherwise.
+	defaultJobTTL = time.Hour
+)
+
+var (
+	// ErrNotCompleted is returned when the result of a job that has not
+	// completed is requested.
+	ErrNotCompleted = errors.New("crawl not completed")
+	// ErrTimeout is returned when the result of a job that timed out is
+	// requested.
+	ErrTimeout = errors.New("crawl timed out")
+)
+
+// Job is a crawl running in the background.
+type Job struct {
+	ID           string
+	URL          string
+	StartTime    time.Time
+	endTime      time.Time
+	status       JobStatus
+	pagesVisited int
+	queueDepth   int
+	errors       []string
+	skipped      []*Skip
+	limitReached string
+	err          error
+	options      Options
+	cacheOptions Options
+	quotaCapped  bool
+	result       *Result
+	pages        []*PageEvent
+	subscribers  map[chan *PageEvent]bool
+	store        Store
+	cache        *ResultCache
+	lease        *quota.Lease
+	cancel       context.CancelFunc
+	lock         *sync.RWMutex
+}
+
+// Skip is a page the crawl chose not to fetch.
+type Skip struct {
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// JobSummary is a snapshot of the state of a job.
+type JobSummary struct {
+	ID           string     `json:"id"`
+	URL          string     `json:"url"`
+	Status       JobStatus  `json:"status"`
+	PagesVisited int        `json:"pagesVisited"`
+	QueueDepth   int        `json:"queueDepth"`
+	Errors       []string   `json:"errors"`
+	Skipped      []*Skip    `json:"skipped"`
+	LimitReached string     `json:"limitReached,omitempty"`
+	Owner        string     `json:"owner,omitempty"`
+	StartTime    time.Time  `json:"startTime"`
+	EndTime      *time.Time `json:"endTime,omitempty"`
+}
+
+// JobManager tracks the crawl jobs started by the server. Completed crawls
+// are saved to the store, and to the result cache when one is set. Finished
+// jobs are dropped after the job ttl, their results staying in the store.
+// Crawls are only started while their owner is within the quotas, when quotas
+// are set.
+type JobManager struct {
+	jobs      map[string]*Job
+	jobTTL    time.Duration
+	store     Store
+	defaults  Options
+	siteRules *SiteRuleFile
+	quotas    *quota.Tracker
+	cache     *ResultCache
+	lock      *sync.RWMutex
+}
+
+// NewJobManager creates an empty job manager saving results to the store.
+// The default options are used for crawls that do not override them and the
+// site rules for the url and title rules of each site crawled.
+func NewJobManager(store Store, defaults Options, siteRules *SiteRuleFile) *JobManager {
+	return &JobManager{
+		jobs:      map[string]*Job{},
+		jobTTL:    defaultJobTTL,
+		store:     store,
+		defaults:  defaults,
+		siteRules: siteRules,
+		lock:      &sync.RWMutex{},
+	}
+}
+
+// SetJobTTL sets how long finished jobs are kept for their status and events.
+func (m *JobManager) SetJobTTL(ttl time.Duration) {
+	m.jobTTL = ttl
+}
+
+// SetQuotas sets the limits on the crawls the server and each owner can run.
+func (m *JobManager) SetQuotas(quotas *quota.Tracker) {
+	m.quotas = quotas
+}
+
+// SetCache sets the cache holding recent crawl results.
+func (m *JobManager) SetCache(cache *ResultCache) {
+	m.cache = cache
+}
+
+// Cached returns the cached result of a recent crawl of the site with the
+// same options.
+func (m *JobManager) Cached(root *url.URL, options Options) (*Result, bool) {
+	if m.cache == nil {
+		return nil, false
+	}
+
+	return m.cache.Get(root, m.withSiteRules(root, options))
+}
+
+// SiteRules returns the url and title rules of the sites crawled.
+func (m *JobManager) SiteRules() *SiteRuleFile {
+	return m.siteRules
+}
+
+// DefaultOptions returns the crawl options configured for the server.
+func (m *JobManager) DefaultOptions() Options {
+	return m.defaults
+}
+
+// Start begins crawling the site in the background and returns the new job.
+func (m *JobManager) Start(root *url.URL, options Options) (*Job, error) {
+	job, ctx, err := m.newJob(context.Background(), root, options)
+	if err != nil {
+		return nil, err
+	}
+
+	m.register(job)
+	go job.run(ctx, root)
+
+	return job, nil
+}
+
+// Run crawls the site, waiting for the crawl to finish before returning the
+// result. The crawl is not tracked as a job, its result only being saved to
+// the store.
+func (m *JobManager) Run(ctx context.Context, root *url.URL, options Options) (*Result, error) {
+	job, jobCtx, err := m.newJob(ctx, root, options)
+	if err != nil {
+		return nil, err
+	}
+
+	job.run(jobCtx, root)
+
+	return job.Result()
+}
+
+func (m *JobManager) newJob(parent context.Context, root *url.URL, options Options) (*Job, context.Context, error) {
+	id, err := createID()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to create job id")
+	}
+
+	err = options.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+	options = m.withSiteRules(root, options)
+	// the result is cached under the options as asked for, which is how later
+	// requests look it up, rather than the pages left in the quotas
+	cacheOptions := options
+	var lease *quota.Lease
+	if m.quotas != nil {
+		lease, err = m.quotas.Acquire(options.Owner, options.MaxPages)
+		if err != nil {
+			return nil, nil, err
+		}
+		options.MaxPages = lease.Pages
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	job := &Job{
+		ID:           id,
+		URL:          root.String(),
+		StartTime:    time.Now(),
+		status:       JobRunning,
+		errors:       []string{},
+		skipped:      []*Skip{},
+		options:      options,
+		cacheOptions: cacheOptions,
+		quotaCapped:  options.MaxPages != cacheOptions.MaxPages,
+		pages:        []*PageEvent{},
+		subscribers:  map[chan *PageEvent]bool{},
+		store:        m.store,
+		cache:        m.cache,
+		lease:        lease,
+		cancel:       cancel,
+		lock:         &sync.RWMutex{},
+	}
+
+	if options.Owner != "" {
+		log.Infof("audit: '%s' started crawl job %s for site '%s'", options.Owner, id, job.URL)
+	}
+
+	return job, ctx, nil
+}
+
+// register tracks the job, dropping the jobs that finished more than the job
+// ttl ago.
+func (m *JobManager) register(job *Job) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	expired := time.Now().Add(-m.jobTTL)
+	for id, j := range m.jobs {
+		if j.finishedBefore(expired) {
+			delete(m.jobs, id)
+		}
+	}
+	m.jobs[job.ID] = job
+}
+
+// withSiteRules returns the options with the url and title rules of the site
+// in place of any not set.
+func (m *JobManager) withSiteRules(root *url.URL, options Options) Options {
+	siteRules := m.siteRules.ForHost(root.Hostname())
+	if options.Canonical == nil {
+		options.Canonical = siteRules.Canonical
+	}
+	if options.Titles == nil {
+		options.Titles = siteRules.Titles
+	}
+
+	return options
+}
+
+// Get returns the job with the given id.
+func (m *JobManager) Get(id string) (*Job, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+// Result returns the result of a completed crawl, either from a job started
+// by this manager or from the store.
+func (m *JobManager) Result(id string) (*Result, error) {
+	job, ok := m.Get(id)
+	if ok {
+		return job.Result()
+	}
+
+	return m.store.Load(id)
+}
+
+func (j *Job) run(ctx context.Context, root *url.URL) {
+	log.Infof("starting crawl job %s for site '%s'", j.ID, j.URL)
+	result, err := Crawl(ctx, root, j.options, j)
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.endTime = time.Now()
+	j.queueDepth = 0
+	if ctx.Err() == context.DeadlineExceeded {
+		j.status = JobTimedOut
+	} else if ctx.Err() != nil {
+		j.status = JobCancelled
+	} else if err != nil {
+		j.status = JobFailed
+		j.err = err
+		j.errors = append(j.errors, err.Error())
+	} else {
+		j.status = JobCompleted
+		result.Metadata = &Metadata{
+			ID:           j.ID,
+			URL:          j.URL,
+			StartTime:    j.StartTime,
+			EndTime:      j.endTime,
+			PageCount:    len(result.Propositions),
+			LimitReached: j.limitReached,
+			IDs:          j.options.IDs,
+		}
+		j.result = result
+		err = j.store.Save(j.result)
+		if err != nil {
+			log.Errorf("%+v", err)
+			j.errors = append(j.errors, err.Error())
+		}
+		// a crawl cut short by the quotas is not the crawl the options ask for
+		if j.cache != nil && !(j.quotaCapped && j.limitReached == LimitPages) {
+			depths := map[string]int{}
+			for _, page := range j.pages {
+				depths[page.URL] = page.Depth
+			}
+			j.cache.Put(root, j.cacheOptions, j.result, depths)
+		}
+	}
+	for sub := range j.subscribers {
+		close(sub)
+	}
+	j.subscribers = map[chan *PageEvent]bool{}
+	j.cancel()
+	if j.lease != nil {
+		j.lease.Release()
+	}
+	log.Infof("crawl job %s %s after visiting %d pages", j.ID, j.status, j.pagesVisited)
+	for _, skip := range j.skipped {
+		log.Infof("crawl job %s skipped '%s' due to %s", j.ID, skip.URL, skip.Reason)
+	}
+}
+
+// finishedBefore returns true if the job ended before the time.
+func (j *Job) finishedBefore(t time.Time) bool {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	return j.status != JobRunning && j.endTime.Before(t)
+}
+
+// Cancel stops the crawl if it is still running.
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// Summary returns a snapshot of the job state.
+func (j *Job) Summary() *JobSummary {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	return j.summary()
+}
+
+func (j *Job) summary() *JobSummary {
+	summary := &JobSummary{
+		ID:           j.ID,
+		URL:          j.URL,
+		Status:       j.status,
+		PagesVisited: j.pagesVisited,
+		QueueDepth:   j.queueDepth,
+		Errors:       append([]string{}, j.errors...),
+		Skipped:      append([]*Skip{}, j.skipped...),
+		LimitReached: j.limitReached,
+		Owner:        j.options.Owner,
+		StartTime:    j.StartTime,
+	}
+	if !j.endTime.IsZero() {
+		endTime := j.endTime
+		summary.EndTime = &endTime
+	}
+
+	return summary
+}
+
+// Result returns the result of a completed job.
+func (j *Job) Result() (*Result, error) {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	switch j.status {
+	case JobCompleted:
+		return j.result, nil
+	case JobTimedOut:
+		return nil, errors.Wrapf(ErrTimeout, "crawl job %s", j.ID)
+	case JobFailed:
+		return nil, errors.Wrapf(j.err, "crawl job %s failed", j.ID)
+	default:
+		return nil, errors.Wrapf(ErrNotCompleted, "crawl job %s is %s", j.ID, j.status)
+	}
+}
+
+// Subscribe returns the pages visited so far along with a channel that
+// receives each page visited after that. The channel is closed when the job
+// ends. The returned function stops the subscription.
+func (j *Job) Subscribe() ([]*PageEvent, <-chan *PageEvent, func()) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	sub := make(chan *PageEvent, subscriberBufferSize)
+	if j.status == JobRunning {
+		j.subscribers[sub] = true
+	} else {
+		close(sub)
+	}
+	unsubscribe := func() {
+		j.lock.Lock()
+		defer j.lock.Unlock()
+		delete(j.subscribers, sub)
+	}
+
+	return append([]*PageEvent{}, j.pages...), sub, unsubscribe
+}
+
+// Visited records a page reached by the crawl.
+func (j *Job) Visited(page *PageEvent) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.pagesVisited++
+	j.pages = append(j.pages, page)
+	if j.lease != nil {
+		j.lease.Visit()
+	}
+	for sub := range j.subscribers {
+		select {
+		case sub <- page:
+		default:
+			log.Warnf("crawl job %s subscriber is not keeping up, dropping page '%s'", j.ID, page.URL)
+		}
+	}
+}
+
+// Skipped records a page the crawl chose not to fetch.
+func (j *Job) Skipped(url string, reason string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.skipped = append(j.skipped, &Skip{URL: url, Reason: reason})
+}
+
+// Limited records the limit that ended the crawl.
+func (j *Job) Limited(limit string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.limitReached = limit
+}
+
+// Failed records a page that could not be crawled.
+func (j *Job) Failed(url string, err error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.errors = append(j.errors, fmt.Sprintf("%s: %v", url, err))
+}
+
+// Queued records the number of pages waiting to be crawled.
+func (j *Job) Queued(depth int) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.queueDepth = depth
+}
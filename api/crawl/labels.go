@@ -0,0 +1,177 @@
+package crawl
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+)
+
+const (
+	// LabelTitle is the text of the page <title>.
+	LabelTitle = "title"
+	// LabelOGTitle is the Open Graph title of the page.
+	LabelOGTitle = "og:title"
+	// LabelH1 is the text of the first <h1> on the page.
+	LabelH1 = "h1"
+	// LabelBreadcrumb is the last item of the page breadcrumb.
+	LabelBreadcrumb = "breadcrumb"
+	// LabelAriaLabel is the aria-label of the main content of the page.
+	LabelAriaLabel = "aria-label"
+	// LabelAnchor is the text of the link the page was first found through.
+	LabelAnchor = "anchor"
+
+	// LabelRuleFirst picks the first label found in priority order.
+	LabelRuleFirst = "first"
+	// LabelRuleShortest picks the shortest label found.
+	LabelRuleShortest = "shortest"
+	// LabelRuleLongest picks the longest label found.
+	LabelRuleLongest = "longest"
+	// LabelRuleCommon picks the label found by the most sources, falling back
+	// to priority order on a tie.
+	LabelRuleCommon = "common"
+)
+
+var (
+	// LabelSources lists the sources labels can be found in.
+	LabelSources = []string{LabelTitle, LabelOGTitle, LabelH1, LabelBreadcrumb, LabelAriaLabel, LabelAnchor}
+	// DefaultLabels is the priority order used when the options set none.
+	DefaultLabels = []string{LabelTitle, LabelOGTitle, LabelH1, LabelBreadcrumb, LabelAriaLabel, LabelAnchor}
+
+	// LabelRules lists the rules for choosing between the labels found.
+	LabelRules = []string{LabelRuleFirst, LabelRuleShortest, LabelRuleLongest, LabelRuleCommon}
+
+	ariaLabelSelectors = []string{"main[aria-label]", `[role="main"][aria-label]`, "body[aria-label]"}
+)
+
+type labelExtractor func(doc *goquery.Document, anchor string) string
+
+var labelExtractors = map[string]labelExtractor{
+	LabelTitle: func(doc *goquery.Document, anchor string) string {
+		return doc.Find("head title").First().Text()
+	},
+	LabelOGTitle: func(doc *goquery.Document, anchor string) string {
+		return doc.Find(`meta[property="og:title"]`).First().AttrOr("content", "")
+	},
+	LabelH1: func(doc *goquery.Document, anchor string) string {
+		return doc.Find("h1").First().Text()
+	},
+	LabelBreadcrumb: func(doc *goquery.Document, anchor string) string {
+		if crumbs := extractBreadcrumb(doc); len(crumbs) > 0 {
+			return crumbs[len(crumbs)-1].Name
+		}
+		return ""
+	},
+	LabelAriaLabel: func(doc *goquery.Document, anchor string) string {
+		for _, selector := range ariaLabelSelectors {
+			if label, ok := doc.Find(selector).First().Attr("aria-label"); ok {
+				return label
+			}
+		}
+		return ""
+	},
+	LabelAnchor: func(doc *goquery.Document, anchor string) string {
+		return anchor
+	},
+}
+
+// validateLabels checks the label sources and the rule choosing between them.
+func validateLabels(sources []string, rule string) error {
+	for _, s := range sources {
+		if _, ok := labelExtractors[s]; !ok {
+			return errors.Errorf("unknown label source '%s'", s)
+		}
+	}
+	if rule != "" && !containsString(LabelRules, rule) {
+		return errors.Errorf("unknown label rule '%s'", rule)
+	}
+
+	return nil
+}
+
+// extractLabels returns the labels found by each source in priority order,
+// including repeats. The document is nil for pages that are not HTML, leaving
+// only the anchor text.
+func extractLabels(doc *goquery.Document, anchor string, sources []string) []string {
+	if len(sources) == 0 {
+		sources = DefaultLabels
+	}
+
+	labels := []string{}
+	for _, s := range sources {
+		extract, ok := labelExtractors[s]
+		if !ok || (doc == nil && s != LabelAnchor) {
+			continue
+		}
+		if label := cleanLabel(extract(doc, anchor)); label != "" {
+			labels = append(labels, label)
+		}
+	}
+
+	return labels
+}
+
+// chooseLabel picks the tag from the labels using the rule.
+func chooseLabel(labels []string, rule string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	chosen := labels[0]
+	switch rule {
+	case LabelRuleShortest:
+		for _, l := range labels {
+			if len(l) < len(chosen) {
+				chosen = l
+			}
+		}
+	case LabelRuleLongest:
+		for _, l := range labels {
+			if len(l) > len(chosen) {
+				chosen = l
+			}
+		}
+	case LabelRuleCommon:
+		counts := map[string]int{}
+		for _, l := range labels {
+			counts[l]++
+		}
+		for _, l := range labels {
+			if counts[l] > counts[chosen] {
+				chosen = l
+			}
+		}
+	}
+
+	return chosen
+}
+
+// labelPage returns the tag and potential tags of a page, falling back to
+// its url path when no label is found.
+func labelPage(doc *goquery.Document, anchor string, page string, options Options) (string, []string) {
+	labels := extractLabels(doc, anchor, options.Labels)
+	tag := chooseLabel(labels, options.LabelRule)
+	if tag == "" {
+		pageURL, err := url.Parse(page)
+		if err != nil {
+			return page, []string{page}
+		}
+		tag = pathLabel(pageURL)
+	}
+
+	potentialTags := []string{}
+	seen := map[string]bool{}
+	for _, l := range append(labels, tag) {
+		if !seen[l] {
+			seen[l] = true
+			potentialTags = append(potentialTags, l)
+		}
+	}
+
+	return tag, potentialTags
+}
+
+func cleanLabel(label string) string {
+	return strings.Join(strings.Fields(label), " ")
+}
@@ -0,0 +1,123 @@
+package crawl
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// LimitDepth is reached when links are found below the maximum depth.
+	LimitDepth = "maxDepth"
+	// LimitPages is reached when the maximum number of pages are queued.
+	LimitPages = "maxPages"
+	// LimitDuration is reached when the crawl runs for the maximum duration.
+	LimitDuration = "maxDuration"
+	// LimitBytes is reached when the maximum number of bytes are downloaded.
+	LimitBytes = "maxBytes"
+)
+
+// limiter tracks a crawl against the limits in its options. A limit of 0 means
+// unlimited.
+type limiter struct {
+	maxDepth     int
+	maxPages     int
+	maxBytes     int64
+	deadline     time.Time
+	pages        int
+	bytes        int64
+	stoppedBy    string
+	pagesReached bool
+	depthReached bool
+	lock         *sync.Mutex
+}
+
+func newLimiter(options Options) *limiter {
+	l := &limiter{
+		maxDepth: options.MaxDepth,
+		maxPages: options.MaxPages,
+		maxBytes: options.MaxBytes,
+		lock:     &sync.Mutex{},
+	}
+	if options.MaxDuration > 0 {
+		l.deadline = time.Now().Add(options.MaxDuration)
+	}
+
+	return l
+}
+
+// allowPage returns true if a page at the given depth can be queued, counting
+// it against the page limit.
+func (l *limiter) allowPage(depth int) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.stopped() {
+		return false
+	}
+	if l.maxDepth > 0 && depth > l.maxDepth {
+		l.depthReached = true
+		return false
+	}
+	if l.maxPages > 0 && l.pages >= l.maxPages {
+		l.pagesReached = true
+		return false
+	}
+	l.pages++
+
+	return true
+}
+
+// allowFetch returns true if the crawl is still within the duration and byte
+// limits, which end the crawl outright rather than only stopping new links.
+func (l *limiter) allowFetch() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return !l.stopped()
+}
+
+// downloaded counts the bytes of a fetched page against the byte limit.
+func (l *limiter) downloaded(bytes int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.bytes += int64(bytes)
+	if l.maxBytes > 0 && l.bytes >= l.maxBytes {
+		l.stop(LimitBytes)
+	}
+}
+
+// reached returns the limit that ended the crawl, if any. Limits that stop the
+// crawl outright take precedence over those that only stop links being queued.
+func (l *limiter) reached() string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.stoppedBy != "" {
+		return l.stoppedBy
+	} else if l.pagesReached {
+		return LimitPages
+	} else if l.depthReached {
+		return LimitDepth
+	}
+
+	return ""
+}
+
+func (l *limiter) stopped() bool {
+	if l.stoppedBy != "" {
+		return true
+	}
+	if !l.deadline.IsZero() && time.Now().After(l.deadline) {
+		l.stop(LimitDuration)
+		return true
+	}
+
+	return false
+}
+
+func (l *limiter) stop(limit string) {
+	if l.stoppedBy == "" {
+		l.stoppedBy = limit
+	}
+}
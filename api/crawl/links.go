@@ -0,0 +1,74 @@
+package crawl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+	"golang.org/x/net/html"
+)
+
+// newLink describes the anchor element linking the source page to the target.
+func newLink(e *colly.HTMLElement, source string, target string) *Link {
+	link := &Link{
+		Source: source,
+		Target: target,
+		Text:   anchorText(e),
+		Index:  e.Index,
+	}
+	if rel := strings.Fields(strings.ToLower(e.Attr("rel"))); len(rel) > 0 {
+		link.Rel = rel
+	}
+	if len(e.DOM.Nodes) > 0 {
+		link.Position = domPath(e.DOM.Nodes[0])
+	}
+
+	return link
+}
+
+// anchorText returns the visible text of the anchor, falling back to the
+// accessible name of an icon or image link.
+func anchorText(e *colly.HTMLElement) string {
+	candidates := []string{
+		e.Text,
+		e.Attr("aria-label"),
+		e.Attr("title"),
+		e.ChildAttr("img", "alt"),
+	}
+	for _, c := range candidates {
+		if text := strings.Join(strings.Fields(c), " "); text != "" {
+			return text
+		}
+	}
+
+	return ""
+}
+
+// domPath returns an XPath style location of the element, such as
+// /html/body/nav/ul/li[2]/a. Positions are only given when the element has
+// siblings with the same tag.
+func domPath(node *html.Node) string {
+	segments := []string{}
+	for n := node; n != nil && n.Type == html.ElementNode; n = n.Parent {
+		position, count := 1, 1
+		if n.Parent != nil {
+			count = 0
+			for s := n.Parent.FirstChild; s != nil; s = s.NextSibling {
+				if s.Type != html.ElementNode || s.Data != n.Data {
+					continue
+				}
+				count++
+				if s == n {
+					position = count
+				}
+			}
+		}
+		segment := n.Data
+		if count > 1 {
+			segment = fmt.Sprintf("%s[%d]", n.Data, position)
+		}
+		segments = append([]string{segment}, segments...)
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
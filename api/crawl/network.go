@@ -0,0 +1,228 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	dialTimeout  = 30 * time.Second
+	maxRedirects = 10
+
+	skipBlocked = "blocked"
+
+	blockedLoopback  = "loopback address"
+	blockedLinkLocal = "link-local address"
+	blockedMulticast = "multicast address"
+	blockedPrivate   = "private address"
+	blockedScheme    = "redirect scheme"
+	blockedHost      = "redirect host"
+	blockedSitemap   = "sitemap host"
+)
+
+var (
+	// privateNetworks are the ranges not reachable from the internet, other
+	// than the loopback, link-local and multicast ranges which net.IP reports
+	// itself. The reserved range includes the broadcast address.
+	privateNetworks = mustParseCIDRs(
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.0.2.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"198.51.100.0/24",
+		"203.0.113.0/24",
+		"240.0.0.0/4",
+		"2001:db8::/32",
+		"fc00::/7",
+	)
+
+	// the IPv6 ranges that carry an IPv4 address, checked as that address
+	nat64Network          = mustParseCIDRs("64:ff9b::/96")[0]
+	sixToFourNetwork      = mustParseCIDRs("2002::/16")[0]
+	ipv4CompatibleNetwork = mustParseCIDRs("::/96")[0]
+)
+
+// BlockedError is returned when the crawl refuses to connect to an address or
+// follow a redirect.
+type BlockedError struct {
+	Target string
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("blocked %s: %s", e.Reason, e.Target)
+}
+
+// ParseNetworks parses the CIDR ranges of the networks a crawl may connect to
+// even though they are private.
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		if cidr == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse network '%s'", cidr)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks, err := ParseNetworks(cidrs)
+	if err != nil {
+		panic(err)
+	}
+
+	return networks
+}
+
+// blockedAddress returns why the address cannot be connected to, or an empty
+// string when it can. Loopback, link-local, multicast and private addresses
+// are blocked unless they are in one of the allowed networks. IPv4-mapped
+// addresses are checked as IPv4 addresses, as are the IPv4 addresses carried
+// by NAT64, 6to4 and IPv4-compatible addresses.
+func blockedAddress(ip net.IP, allowed []*net.IPNet) string {
+	for _, network := range allowed {
+		if network.Contains(ip) {
+			return ""
+		}
+	}
+
+	switch {
+	case ip.IsLoopback():
+		return blockedLoopback
+	case ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast():
+		return blockedLinkLocal
+	case ip.IsMulticast():
+		return blockedMulticast
+	case ip.IsUnspecified():
+		return blockedPrivate
+	}
+	if embedded := embeddedIPv4(ip); embedded != nil {
+		return blockedAddress(embedded, allowed)
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return blockedPrivate
+		}
+	}
+
+	return ""
+}
+
+// embeddedIPv4 returns the IPv4 address carried by a NAT64, 6to4 or
+// IPv4-compatible IPv6 address, or nil for any other address. IPv4-mapped
+// addresses are already treated as IPv4 addresses by net.IP.
+func embeddedIPv4(ip net.IP) net.IP {
+	if ip.To4() != nil || len(ip) != net.IPv6len {
+		return nil
+	}
+
+	switch {
+	case nat64Network.Contains(ip), ipv4CompatibleNetwork.Contains(ip):
+		return net.IPv4(ip[12], ip[13], ip[14], ip[15])
+	case sixToFourNetwork.Contains(ip):
+		return net.IPv4(ip[2], ip[3], ip[4], ip[5])
+	}
+
+	return nil
+}
+
+// newTransport returns a transport that only connects to the addresses the
+// options allow. The address is checked once resolved, so a hostname that
+// resolves to a blocked address is refused along with the address itself. No
+// proxy is used since the proxy address would be checked instead of the site.
+func newTransport(options Options) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: dialTimeout,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return &BlockedError{Target: address, Reason: blockedPrivate}
+			}
+			if reason := blockedAddress(ip, options.AllowNetworks); reason != "" {
+				return &BlockedError{Target: address, Reason: reason}
+			}
+			return nil
+		},
+	}
+
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		},
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// checkRedirect refuses redirects away from the http and https schemes or to
+// a host the options do not allow, so every hop is held to the same rules as
+// the root. Without AllowHost redirects are kept on the root's host.
+func checkRedirect(root *url.URL, options Options) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return errors.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return &BlockedError{Target: req.URL.String(), Reason: blockedScheme}
+		}
+		host := req.URL.Hostname()
+		if options.AllowHost != nil {
+			if !options.AllowHost(host) {
+				return &BlockedError{Target: req.URL.String(), Reason: blockedHost}
+			}
+		} else if host != root.Hostname() {
+			return &BlockedError{Target: req.URL.String(), Reason: blockedHost}
+		}
+		return nil
+	}
+}
+
+// checkSitemap refuses sitemaps away from the http and https schemes, or on a
+// host other than the site that the options do not allow, since robots.txt
+// can list sitemaps on any host.
+func checkSitemap(root *url.URL, options Options, sitemapURL *url.URL) error {
+	if sitemapURL.Scheme != "http" && sitemapURL.Scheme != "https" {
+		return &BlockedError{Target: sitemapURL.String(), Reason: blockedSitemap}
+	}
+	host := sitemapURL.Hostname()
+	if host == root.Hostname() {
+		return nil
+	}
+	if options.AllowHost != nil && !options.AllowHost(host) {
+		return &BlockedError{Target: sitemapURL.String(), Reason: blockedSitemap}
+	}
+
+	return nil
+}
+
+// blockedError returns the blocked error the request failed with, if any.
+func blockedError(err error) (*BlockedError, bool) {
+	var blocked *BlockedError
+	ok := errors.As(err, &blocked)
+	return blocked, ok
+}
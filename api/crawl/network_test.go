@@ -0,0 +1,215 @@
+package crawl
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestBlockedAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"93.184.216.34", ""},
+		{"2606:2800:220:1:248:1893:25c8:1946", ""},
+		{"127.0.0.1", blockedLoopback},
+		{"127.8.8.8", blockedLoopback},
+		{"::1", blockedLoopback},
+		{"169.254.169.254", blockedLinkLocal},
+		{"fe80::1", blockedLinkLocal},
+		{"224.0.0.1", blockedLinkLocal},
+		{"239.1.2.3", blockedMulticast},
+		{"ff02::1", blockedLinkLocal},
+		{"ff0e::1", blockedMulticast},
+		{"0.0.0.0", blockedPrivate},
+		{"::", blockedPrivate},
+		{"10.1.2.3", blockedPrivate},
+		{"100.64.0.1", blockedPrivate},
+		{"172.16.5.4", blockedPrivate},
+		{"192.168.1.1", blockedPrivate},
+		{"198.18.0.1", blockedPrivate},
+		{"192.0.2.1", blockedPrivate},
+		{"240.0.0.1", blockedPrivate},
+		{"255.255.255.255", blockedPrivate},
+		{"fd00::1", blockedPrivate},
+		// IPv4-mapped addresses
+		{"::ffff:127.0.0.1", blockedLoopback},
+		{"::ffff:10.0.0.1", blockedPrivate},
+		{"::ffff:169.254.169.254", blockedLinkLocal},
+		{"::ffff:93.184.216.34", ""},
+		// IPv4 addresses carried by NAT64, 6to4 and IPv4-compatible addresses
+		{"64:ff9b::7f00:1", blockedLoopback},
+		{"64:ff9b::a9fe:a9fe", blockedLinkLocal},
+		{"64:ff9b::5db8:d822", ""},
+		{"2002:0a00:0001::1", blockedPrivate},
+		{"2002:5db8:d822::1", ""},
+		{"::10.0.0.1", blockedPrivate},
+		{"::127.0.0.1", blockedLoopback},
+	}
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			ip := net.ParseIP(test.address)
+			if ip == nil {
+				t.Fatalf("unable to parse '%s'", test.address)
+			}
+			if got := blockedAddress(ip, nil); got != test.want {
+				t.Errorf("blockedAddress(%s) = %q, want %q", test.address, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBlockedAddressAllowedNetworks(t *testing.T) {
+	allowed, err := ParseNetworks([]string{"127.0.0.1/32", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("unable to parse networks: %v", err)
+	}
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"127.0.0.1", ""},
+		{"::ffff:127.0.0.1", ""},
+		{"127.0.0.2", blockedLoopback},
+		{"10.9.9.9", ""},
+		{"192.168.1.1", blockedPrivate},
+	}
+	for _, test := range tests {
+		if got := blockedAddress(net.ParseIP(test.address), allowed); got != test.want {
+			t.Errorf("blockedAddress(%s) = %q, want %q", test.address, got, test.want)
+		}
+	}
+}
+
+func TestTransportBlocksPrivateAddresses(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer site.Close()
+
+	client := &http.Client{Transport: newTransport(Options{})}
+	_, err := client.Get(site.URL)
+	blocked, ok := blockedError(err)
+	if !ok || blocked.Reason != blockedLoopback {
+		t.Errorf("expected the loopback address to be blocked, got %v", err)
+	}
+
+	allowed, _ := ParseNetworks([]string{"127.0.0.1/32"})
+	client = &http.Client{Transport: newTransport(Options{AllowNetworks: allowed})}
+	resp, err := client.Get(site.URL)
+	if err != nil {
+		t.Fatalf("allowed network was blocked: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestCheckRedirect(t *testing.T) {
+	root, _ := url.Parse("http://example.com/")
+	allowHost := func(host string) bool {
+		return host == "example.com" || host == "other.com"
+	}
+	tests := []struct {
+		name   string
+		target string
+		via    int
+		allow  func(string) bool
+		reason string
+		failed bool
+	}{
+		{"same site", "https://example.com/page", 1, allowHost, "", false},
+		{"other allowed site", "http://other.com/", 1, allowHost, "", false},
+		{"same site without allowed sites", "https://example.com/page", 1, nil, "", false},
+		{"other site", "http://internal.local/", 1, allowHost, blockedHost, true},
+		{"other site without allowed sites", "http://internal.local/", 1, nil, blockedHost, true},
+		{"metadata address", "http://169.254.169.254/latest", 1, allowHost, blockedHost, true},
+		{"file scheme", "file:///etc/passwd", 1, allowHost, blockedScheme, true},
+		{"too many redirects", "http://example.com/page", maxRedirects, allowHost, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target, _ := url.Parse(test.target)
+			via := make([]*http.Request, test.via)
+			err := checkRedirect(root, Options{AllowHost: test.allow})(&http.Request{URL: target}, via)
+			if !test.failed {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected the redirect to be refused")
+			}
+			if test.reason == "" {
+				return
+			}
+			blocked, ok := blockedError(err)
+			if !ok || blocked.Reason != test.reason {
+				t.Errorf("got %v, want a blocked %s", err, test.reason)
+			}
+		})
+	}
+}
+
+func TestRedirectToOtherHost(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("secret"))
+	}))
+	defer internal.Close()
+	internalURL, _ := url.Parse(internal.URL)
+	internalURL.Host = "localhost:" + internalURL.Port()
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internalURL.String(), http.StatusFound)
+	}))
+	defer site.Close()
+
+	// the site itself is reachable, but the redirect leaves it for another host
+	root, _ := url.Parse(site.URL)
+	allowed, _ := ParseNetworks([]string{"127.0.0.1/32"})
+	options := Options{AllowNetworks: allowed}
+	client := &http.Client{Transport: newTransport(options), CheckRedirect: checkRedirect(root, options)}
+	_, err := client.Get(site.URL)
+	blocked, ok := blockedError(err)
+	if !ok || blocked.Reason != blockedHost {
+		t.Errorf("expected the redirect off the site to be refused, got %v", err)
+	}
+
+	// the other host is followed once the allowed sites accept it
+	allowed, _ = ParseNetworks([]string{"127.0.0.1/32", "::1/128"})
+	options = Options{AllowNetworks: allowed, AllowHost: func(host string) bool { return host == "localhost" }}
+	client = &http.Client{Transport: newTransport(options), CheckRedirect: checkRedirect(root, options)}
+	resp, err := client.Get(site.URL)
+	if err != nil {
+		t.Fatalf("redirect to an allowed host was refused: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestCheckSitemap(t *testing.T) {
+	root, _ := url.Parse("https://example.com/")
+	allowHost := func(host string) bool {
+		return host == "example.com" || host == "cdn.example.com"
+	}
+	tests := []struct {
+		sitemap string
+		allow   func(string) bool
+		ok      bool
+	}{
+		{"https://example.com/sitemap.xml", allowHost, true},
+		{"http://example.com/sitemap.xml", allowHost, true},
+		{"https://cdn.example.com/sitemap.xml", allowHost, true},
+		{"https://internal.local/sitemap.xml", allowHost, false},
+		{"http://169.254.169.254/latest/meta-data", allowHost, false},
+		{"ftp://example.com/sitemap.xml", allowHost, false},
+		{"https://other.com/sitemap.xml", nil, true},
+	}
+	for _, test := range tests {
+		sitemapURL, _ := url.Parse(test.sitemap)
+		err := checkSitemap(root, Options{AllowHost: test.allow}, sitemapURL)
+		if (err == nil) != test.ok {
+			t.Errorf("checkSitemap(%s) = %v, want allowed %v", test.sitemap, err, test.ok)
+		}
+	}
+}
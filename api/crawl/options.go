@@ -0,0 +1,70 @@
+package crawl
+
+import (
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SitemapNone crawls only the pages linked from the root.
+	SitemapNone = ""
+	// SitemapSeed adds the pages listed in the site sitemaps to the crawl.
+	SitemapSeed = "seed"
+	// SitemapOnly builds the graph from the sitemap url paths without
+	// fetching any pages.
+	SitemapOnly = "only"
+)
+
+var (
+	// SitemapModes lists the ways the site sitemaps can be used.
+	SitemapModes = []string{SitemapNone, SitemapSeed, SitemapOnly}
+)
+
+// Options configures how politely a site is crawled, how much of it is
+// crawled, how its page urls are canonicalised and how its pages are labelled.
+// A limit of 0 means unlimited. The start urls are crawled along with the
+// root, given either as urls on the site or as paths relative to the root.
+// Loopback, link-local and private addresses are only fetched when in one of
+// the allowed networks, and redirects are only followed to hosts AllowHost
+// accepts, or to the root's host when it is not set. The owner names who
+// started the crawl in the audit log and is charged for it by the quotas.
+// Pages fetched by an earlier crawl are revalidated against the page cache,
+// when it is set, and only downloaded again when they changed.
+type Options struct {
+	UserAgent     string
+	Parallelism   int
+	Delay         time.Duration
+	RandomDelay   time.Duration
+	RespectRobots bool
+	MaxDepth      int
+	MaxPages      int
+	MaxDuration   time.Duration
+	MaxBytes      int64
+	Sitemap       string
+	Canonical     *CanonicalRules
+	Titles        *TitleRules
+	Labels        []string
+	LabelRule     string
+	IDs           string
+	StartURLs     []string
+	AllowNetworks []*net.IPNet
+	AllowHost     func(host string) bool
+	Owner         string
+	Pages         *PageCache
+}
+
+// Validate checks the options that name one of a set of choices.
+func (o *Options) Validate() error {
+	if !containsString(SitemapModes, o.Sitemap) {
+		return errors.Errorf("unknown sitemap mode '%s'", o.Sitemap)
+	}
+
+	err := validateIDs(o.IDs)
+	if err != nil {
+		return err
+	}
+
+	return validateLabels(o.Labels, o.LabelRule)
+}
@@ -0,0 +1,308 @@
+package crawl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/unchartedsoftware/plog"
+)
+
+const (
+	// maxCachedBody is the largest page kept in the page cache.
+	maxCachedBody = 10 * 1024 * 1024
+
+	pageExtension = ".json"
+
+	pageDirMode  = 0755
+	pageFileMode = 0644
+)
+
+// PageCache keeps the pages fetched by earlier crawls that the site gave an
+// ETag or Last-Modified header, so a later crawl can ask the site whether
+// each page changed and only download the pages that did. Pages not fetched
+// or revalidated within the max age are dropped, then the least recently used
+// pages until the cache fits in the max size. A limit of 0 means unlimited.
+type PageCache struct {
+	dir     string
+	maxAge  time.Duration
+	maxSize int64
+	lock    *sync.RWMutex
+}
+
+// cachedPage is a page as it was last fetched. Only the validators and the
+// content type are kept of its headers, leaving out cookies and the like.
+type cachedPage struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	ContentType  string `json:"contentType,omitempty"`
+	Body         []byte `json:"body"`
+}
+
+// NewPageCache creates a page cache rooted at the given directory, dropping
+// the pages already past the limits.
+func NewPageCache(dir string, maxAge time.Duration, maxSize int64) (*PageCache, error) {
+	err := os.MkdirAll(dir, pageDirMode)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create page cache directory '%s'", dir)
+	}
+
+	p := &PageCache{
+		dir:     dir,
+		maxAge:  maxAge,
+		maxSize: maxSize,
+		lock:    &sync.RWMutex{},
+	}
+	p.prune()
+
+	return p, nil
+}
+
+func (p *PageCache) filename(pageURL string) string {
+	hash := sha256.Sum256([]byte(pageURL))
+	return path.Join(p.dir, hex.EncodeToString(hash[:])+pageExtension)
+}
+
+func (p *PageCache) load(pageURL string) (*cachedPage, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	filename := p.filename(pageURL)
+	info, err := os.Stat(filename)
+	if err != nil || p.expired(info, time.Now()) {
+		return nil, false
+	}
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, false
+	}
+	page := &cachedPage{}
+	err = json.Unmarshal(contents, page)
+	if err != nil || page.URL != pageURL {
+		return nil, false
+	}
+
+	return page, true
+}
+
+func (p *PageCache) save(page *cachedPage) {
+	bytes, err := json.Marshal(page)
+	if err != nil {
+		log.Warnf("unable to marshal cached page '%s': %v", page.URL, err)
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	// write to a temp file first so a failed write never leaves a partial page
+	filename := p.filename(page.URL)
+	err = ioutil.WriteFile(filename+".tmp", bytes, pageFileMode)
+	if err == nil {
+		err = os.Rename(filename+".tmp", filename)
+	}
+	if err != nil {
+		log.Warnf("unable to write cached page '%s': %v", page.URL, err)
+	}
+}
+
+// touch marks the page as used, keeping it in the cache longer.
+func (p *PageCache) touch(pageURL string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now()
+	err := os.Chtimes(p.filename(pageURL), now, now)
+	if err != nil {
+		log.Warnf("unable to touch cached page '%s': %v", pageURL, err)
+	}
+}
+
+func (p *PageCache) expired(info os.FileInfo, now time.Time) bool {
+	return p.maxAge > 0 && info.ModTime().Before(now.Add(-p.maxAge))
+}
+
+// prune drops the pages past the max age, then the least recently used pages
+// until the cache fits in the max size.
+func (p *PageCache) prune() {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	files, err := ioutil.ReadDir(p.dir)
+	if err != nil {
+		log.Warnf("unable to list page cache directory '%s': %v", p.dir, err)
+		return
+	}
+	now := time.Now()
+	kept := []os.FileInfo{}
+	size := int64(0)
+	removed := 0
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), pageExtension) {
+			continue
+		}
+		if p.expired(file, now) {
+			removed += p.remove(file)
+			continue
+		}
+		kept = append(kept, file)
+		size += file.Size()
+	}
+	if p.maxSize > 0 && size > p.maxSize {
+		sort.Slice(kept, func(i, j int) bool {
+			return kept[i].ModTime().Before(kept[j].ModTime())
+		})
+		for _, file := range kept {
+			if size <= p.maxSize {
+				break
+			}
+			removed += p.remove(file)
+			size -= file.Size()
+		}
+	}
+	if removed > 0 {
+		log.Infof("dropped %d pages from the page cache", removed)
+	}
+}
+
+func (p *PageCache) remove(file os.FileInfo) int {
+	err := os.Remove(path.Join(p.dir, file.Name()))
+	if err != nil {
+		log.Warnf("unable to remove cached page '%s': %v", file.Name(), err)
+		return 0
+	}
+
+	return 1
+}
+
+// revalidatingTransport sends the validators of a cached page along with the
+// request for it, answering from the cache when the site replies that the
+// page has not been modified. It counts the pages served from the cache.
+type revalidatingTransport struct {
+	base      http.RoundTripper
+	pages     *PageCache
+	unchanged int
+	lock      *sync.Mutex
+}
+
+// transport returns the base transport revalidating pages against the cache.
+// Requests go straight to the base when there is no cache.
+func (p *PageCache) transport(base http.RoundTripper) *revalidatingTransport {
+	return &revalidatingTransport{
+		base:  base,
+		pages: p,
+		lock:  &sync.Mutex{},
+	}
+}
+
+func (t *revalidatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.pages == nil || req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	pageURL := req.URL.String()
+	cached, ok := t.pages.load(pageURL)
+	if ok {
+		req = req.Clone(req.Context())
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if ok && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		t.pages.touch(pageURL)
+		t.lock.Lock()
+		t.unchanged++
+		t.lock.Unlock()
+		return cached.response(req), nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if resp.StatusCode != http.StatusOK || (etag == "" && lastModified == "") ||
+		strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+		return resp, nil
+	}
+
+	// the body is read up front to keep a copy, leaving a page too large to
+	// keep to be read as usual
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCachedBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if len(body) > maxCachedBody {
+		resp.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	t.pages.save(&cachedPage{
+		URL:          pageURL,
+		ETag:         etag,
+		LastModified: lastModified,
+		ContentType:  resp.Header.Get("Content-Type"),
+		Body:         body,
+	})
+
+	return resp, nil
+}
+
+// unchangedPages returns how many pages were served from the cache.
+func (t *revalidatingTransport) unchangedPages() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.unchanged
+}
+
+// response rebuilds the response the page was cached from, with the headers
+// that were kept.
+func (c *cachedPage) response(req *http.Request) *http.Response {
+	header := http.Header{}
+	for key, value := range map[string]string{
+		"Content-Type":  c.ContentType,
+		"ETag":          c.ETag,
+		"Last-Modified": c.LastModified,
+	} {
+		if value != "" {
+			header.Set(key, value)
+		}
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,118 @@
+package crawl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestPageCache(t *testing.T, maxAge time.Duration, maxSize int64) *PageCache {
+	dir, err := ioutil.TempDir("", "page-cache")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	pages, err := NewPageCache(dir, maxAge, maxSize)
+	if err != nil {
+		t.Fatalf("unable to create page cache: %v", err)
+	}
+
+	return pages
+}
+
+func TestRevalidatingTransport(t *testing.T) {
+	fetches := 0
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Set-Cookie", "session=secret")
+		_, _ = w.Write([]byte("<html>page</html>"))
+	}))
+	defer site.Close()
+
+	pages := newTestPageCache(t, time.Hour, 0)
+	client := &http.Client{Transport: pages.transport(http.DefaultTransport)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(site.URL + "/page")
+		if err != nil {
+			t.Fatalf("unable to fetch page: %v", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "<html>page</html>" {
+			t.Errorf("fetch %d got %d '%s'", i, resp.StatusCode, body)
+		}
+		if resp.Header.Get("Content-Type") != "text/html" {
+			t.Errorf("fetch %d got content type '%s'", i, resp.Header.Get("Content-Type"))
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("got %d fetches, want 2", fetches)
+	}
+	if unchanged := client.Transport.(*revalidatingTransport).unchangedPages(); unchanged != 1 {
+		t.Errorf("got %d unchanged pages, want 1", unchanged)
+	}
+
+	contents, err := ioutil.ReadFile(pages.filename(site.URL + "/page"))
+	if err != nil {
+		t.Fatalf("page was not cached: %v", err)
+	}
+	if strings.Contains(string(contents), "secret") {
+		t.Errorf("cached page kept the cookie: %s", contents)
+	}
+	info, err := os.Stat(pages.filename(site.URL + "/page"))
+	if err != nil || info.Mode().Perm() != pageFileMode {
+		t.Errorf("cached page has mode %v, want %v", info.Mode().Perm(), os.FileMode(pageFileMode))
+	}
+}
+
+func TestPageCachePrune(t *testing.T) {
+	pages := newTestPageCache(t, time.Hour, 0)
+	now := time.Now()
+	for i, age := range []time.Duration{2 * time.Hour, 3 * time.Minute, 2 * time.Minute, time.Minute} {
+		page := &cachedPage{URL: "http://example.com/" + string(rune('a'+i)), Body: make([]byte, 100)}
+		pages.save(page)
+		modified := now.Add(-age)
+		err := os.Chtimes(pages.filename(page.URL), modified, modified)
+		if err != nil {
+			t.Fatalf("unable to set page time: %v", err)
+		}
+	}
+
+	if _, ok := pages.load("http://example.com/a"); ok {
+		t.Error("expired page was loaded")
+	}
+	if _, ok := pages.load("http://example.com/b"); !ok {
+		t.Error("page within the max age was not loaded")
+	}
+
+	// the expired page goes first, then the least recently used
+	info, _ := os.Stat(pages.filename("http://example.com/b"))
+	pages.maxSize = 2*info.Size() + 1
+	pages.prune()
+	files, _ := ioutil.ReadDir(pages.dir)
+	kept := map[string]bool{}
+	for _, file := range files {
+		kept[file.Name()] = true
+	}
+	for url, want := range map[string]bool{
+		"http://example.com/a": false,
+		"http://example.com/b": false,
+		"http://example.com/c": true,
+		"http://example.com/d": true,
+	} {
+		if kept[path.Base(pages.filename(url))] != want {
+			t.Errorf("page '%s' kept %v, want %v", url, !want, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package crawl
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/temoto/robotstxt"
+)
+
+// robots holds the robots.txt rules that apply to the crawler on one host.
+type robots struct {
+	data      *robotstxt.RobotsData
+	userAgent string
+}
+
+func loadRobots(client *http.Client, root *url.URL, userAgent string) (*robots, error) {
+	robotsURL := &url.URL{Scheme: root.Scheme, Host: root.Host, Path: "/robots.txt"}
+	req, err := http.NewRequest(http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create robots.txt request")
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to fetch robots.txt")
+	}
+	defer res.Body.Close()
+
+	data, err := robotstxt.FromResponse(res)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse robots.txt")
+	}
+
+	return &robots{
+		data:      data,
+		userAgent: userAgent,
+	}, nil
+}
+
+// allowed returns true if the rules let the crawler fetch the url.
+func (r *robots) allowed(u *url.URL) bool {
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	return r.data.TestAgent(path, r.userAgent)
+}
+
+// crawlDelay returns the Crawl-delay requested for the crawler.
+func (r *robots) crawlDelay() time.Duration {
+	return r.data.FindGroup(r.userAgent).CrawlDelay
+}
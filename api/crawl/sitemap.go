@@ -0,0 +1,270 @@
+package crawl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/unchartedsoftware/plog"
+)
+
+const (
+	maxSitemapFiles = 100
+	maxSitemapBytes = 50 * 1024 * 1024
+
+	sitemapRootLabel = "Home"
+)
+
+var (
+	wellKnownSitemaps = []string{"/sitemap.xml", "/sitemap_index.xml"}
+	gzipMagic         = []byte{0x1f, 0x8b}
+)
+
+// sitemapDocument matches both a sitemap url set and a sitemap index.
+type sitemapDocument struct {
+	URLs     []sitemapLocation `xml:"url"`
+	Sitemaps []sitemapLocation `xml:"sitemap"`
+}
+
+type sitemapLocation struct {
+	Loc string `xml:"loc"`
+}
+
+// loadSitemaps returns the page urls listed in the site sitemaps. Sitemaps are
+// found through robots.txt, falling back to the well known locations. Sitemaps
+// on other hosts are only fetched from the hosts the options allow.
+func loadSitemaps(client *http.Client, root *url.URL, rules *robots, options Options) []string {
+	pending := []string{}
+	if rules != nil {
+		pending = append(pending, rules.data.Sitemaps...)
+	}
+	if len(pending) == 0 {
+		for _, p := range wellKnownSitemaps {
+			pending = append(pending, (&url.URL{Scheme: root.Scheme, Host: root.Host, Path: p}).String())
+		}
+	}
+
+	pages := []string{}
+	fetched := map[string]bool{}
+	for len(pending) > 0 && len(fetched) < maxSitemapFiles {
+		sitemapURL := strings.TrimSpace(pending[0])
+		pending = pending[1:]
+		if fetched[sitemapURL] {
+			continue
+		}
+		fetched[sitemapURL] = true
+
+		parsed, err := url.Parse(sitemapURL)
+		if err == nil {
+			err = checkSitemap(root, options, parsed)
+		}
+		if err != nil {
+			log.Warnf("skipping sitemap '%s': %v", sitemapURL, err)
+			continue
+		}
+		doc, err := fetchSitemap(client, sitemapURL, options.UserAgent)
+		if err != nil {
+			log.Warnf("skipping sitemap '%s': %v", sitemapURL, err)
+			continue
+		}
+		for _, s := range doc.Sitemaps {
+			pending = append(pending, s.Loc)
+		}
+		for _, u := range doc.URLs {
+			pages = append(pages, strings.TrimSpace(u.Loc))
+		}
+	}
+	log.Infof("found %d pages in %d sitemaps for site '%s'", len(pages), len(fetched), root.String())
+
+	return pages
+}
+
+func fetchSitemap(client *http.Client, sitemapURL string, userAgent string) (*sitemapDocument, error) {
+	req, err := http.NewRequest(http.MethodGet, sitemapURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create sitemap request")
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to fetch sitemap")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("sitemap request returned status %d", res.StatusCode)
+	}
+
+	body, err := readLimited(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read sitemap")
+	}
+
+	// gzipped sitemaps are detected by content since servers rarely label them
+	if bytes.HasPrefix(body, gzipMagic) {
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to open gzipped sitemap")
+		}
+		body, err = readLimited(gz)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read gzipped sitemap")
+		}
+	}
+
+	doc := &sitemapDocument{}
+	err = xml.Unmarshal(body, doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse sitemap")
+	}
+
+	return doc, nil
+}
+
+// fromSitemap builds the propositions from the sitemap url paths alone, each
+// page hanging off its nearest ancestor path.
+func (c *crawler) fromSitemap(sitemapURLs []string) []*Proposition {
+	rootURL := c.canonical(c.root)
+	known := c.sitemapSet(sitemapURLs)
+
+	pages := []*url.URL{}
+	for link := range known {
+		page, err := url.Parse(link)
+		if err != nil || link == rootURL.String() || page.Hostname() != rootURL.Hostname() {
+			continue
+		}
+		pages = append(pages, page)
+	}
+	// parents have shorter paths so sorting by depth adds them first
+	sort.Slice(pages, func(i, j int) bool {
+		di, dj := pathDepth(pages[i]), pathDepth(pages[j])
+		if di != dj {
+			return di < dj
+		}
+		return pages[i].String() < pages[j].String()
+	})
+
+	propositions := []*Proposition{c.sitemapProposition(rootURL, sitemapRootLabel, "", 0)}
+	for _, page := range pages {
+		depth := pathDepth(page)
+		if !c.limits.allowPage(depth) {
+			continue
+		}
+		propositions = append(propositions, c.sitemapProposition(page, pathLabel(page), pathParent(page, known, rootURL.String()), depth))
+	}
+
+	if limit := c.limits.reached(); limit != "" {
+		c.monitor.Limited(limit)
+	}
+
+	return propositions
+}
+
+func (c *crawler) sitemapProposition(page *url.URL, label string, parent string, depth int) *Proposition {
+	prop := &Proposition{
+		ID:            c.options.propositionID(page.String()),
+		Tag:           label,
+		PotentialTags: []string{label},
+		URL:           page.String(),
+		Key:           page.String(),
+		ParentURL:     parent,
+	}
+	c.monitor.Visited(&PageEvent{
+		URL:       prop.URL,
+		ParentURL: prop.ParentURL,
+		Title:     prop.Tag,
+		Depth:     depth,
+	})
+
+	return prop
+}
+
+// sitemapSet returns the canonical urls of the root and the sitemap pages,
+// recording the listed urls that differ as aliases.
+func (c *crawler) sitemapSet(sitemapURLs []string) map[string]bool {
+	known := map[string]bool{c.canonical(c.root).String(): true}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, s := range sitemapURLs {
+		page, err := url.Parse(s)
+		if err != nil {
+			continue
+		}
+		canonical := c.canonical(page).String()
+		c.addAlias(canonical, s)
+		known[canonical] = true
+	}
+
+	return known
+}
+
+// pathParent returns the nearest known url whose path is an ancestor of the
+// page path, falling back to the root.
+func pathParent(page *url.URL, known map[string]bool, root string) string {
+	// a page with a query hangs off the same path without one
+	if page.RawQuery != "" {
+		withoutQuery := &url.URL{Scheme: page.Scheme, Host: page.Host, Path: page.Path}
+		if known[withoutQuery.String()] {
+			return withoutQuery.String()
+		}
+	}
+
+	p := strings.TrimSuffix(page.Path, "/")
+	for strings.Contains(p, "/") {
+		p = p[:strings.LastIndex(p, "/")]
+		for _, candidate := range []string{p + "/", p} {
+			ancestor := &url.URL{Scheme: page.Scheme, Host: page.Host, Path: candidate}
+			if known[ancestor.String()] && ancestor.String() != page.String() {
+				return ancestor.String()
+			}
+		}
+	}
+
+	return root
+}
+
+func pathDepth(page *url.URL) int {
+	trimmed := strings.Trim(page.Path, "/")
+	if trimmed == "" {
+		return 0
+	}
+
+	return strings.Count(trimmed, "/") + 1
+}
+
+// pathLabel turns the last path segment into a readable label.
+func pathLabel(page *url.URL) string {
+	segment := path.Base(strings.TrimSuffix(page.Path, "/"))
+	if unescaped, err := url.PathUnescape(segment); err == nil {
+		segment = unescaped
+	}
+	segment = strings.TrimSuffix(segment, path.Ext(segment))
+	label := strings.TrimSpace(strings.NewReplacer("-", " ", "_", " ").Replace(segment))
+	if label == "" || label == "/" || label == "." {
+		return sitemapRootLabel
+	}
+
+	return label
+}
+
+// readLimited reads the whole reader, failing rather than silently truncating
+// when it holds more than the maximum sitemap size.
+func readLimited(r io.Reader) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r, maxSitemapBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxSitemapBytes {
+		return nil, errors.New("sitemap too large")
+	}
+
+	return body, nil
+}
@@ -0,0 +1,150 @@
+package crawl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/unchartedsoftware/plog"
+
+	"github.com/phorne-uncharted/proposition-poc/api/util"
+)
+
+// SiteRules are the rules for processing the pages of a single site.
+type SiteRules struct {
+	Canonical *CanonicalRules `json:"canonical"`
+	Titles    *TitleRules     `json:"titles"`
+}
+
+// DefaultSiteRules returns the rules used when a site has none of its own.
+func DefaultSiteRules() *SiteRules {
+	return &SiteRules{
+		Canonical: DefaultCanonicalRules(),
+		Titles:    DefaultTitleRules(),
+	}
+}
+
+// SiteRuleSet holds the rules of each site keyed by hostname or wildcard.
+type SiteRuleSet map[string]*SiteRules
+
+// SiteRuleFile holds the site rules read from a JSON file mapping each site to
+// its rules. Sites are matched like the allowed sites: an exact hostname ahead
+// of a wildcard such as '*.example.com', the longest wildcard ahead of shorter
+// ones, and the '*' entry, which replaces the defaults, for every other site.
+// Fields missing from an entry keep their default. The rules can be reloaded
+// while in use, keeping the previous rules if the file is invalid.
+type SiteRuleFile struct {
+	filename string
+	rules    SiteRuleSet
+	modTime  time.Time
+	lock     *sync.RWMutex
+}
+
+// LoadSiteRules reads the per site rules from the file. An empty filename
+// leaves every site on the defaults.
+func LoadSiteRules(filename string) (*SiteRuleFile, error) {
+	f := &SiteRuleFile{
+		filename: filename,
+		rules:    SiteRuleSet{},
+		lock:     &sync.RWMutex{},
+	}
+	if filename == "" {
+		return f, nil
+	}
+
+	err := f.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Reload reads the site rules file again.
+func (f *SiteRuleFile) Reload() error {
+	if f.filename == "" {
+		return nil
+	}
+	log.Infof("loading site rules from file '%s'", f.filename)
+	info, err := os.Stat(f.filename)
+	if err != nil {
+		return errors.Wrap(err, "unable to open site rules file")
+	}
+	contents, err := ioutil.ReadFile(f.filename)
+	if err != nil {
+		return errors.Wrap(err, "unable to read site rules file")
+	}
+	rules, err := parseSiteRules(contents)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	// an invalid file is not read again until it changes
+	f.modTime = info.ModTime()
+	if err != nil {
+		return err
+	}
+	f.rules = rules
+
+	return nil
+}
+
+// Watch reloads the site rules whenever the file changes, checking it at the
+// interval until the stop channel is closed.
+func (f *SiteRuleFile) Watch(interval time.Duration, stop <-chan struct{}) {
+	util.WatchFile(f.filename, "site rules", interval, stop, f.loaded, f.Reload)
+}
+
+func (f *SiteRuleFile) loaded() time.Time {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.modTime
+}
+
+// ForHost returns the rules for the hostname.
+func (f *SiteRuleFile) ForHost(host string) *SiteRules {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.rules.ForHost(host)
+}
+
+func parseSiteRules(contents []byte) (SiteRuleSet, error) {
+	raw := map[string]json.RawMessage{}
+	err := json.Unmarshal(contents, &raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse site rules file")
+	}
+
+	rules := SiteRuleSet{}
+	for site, r := range raw {
+		siteRules := DefaultSiteRules()
+		err = json.Unmarshal(r, siteRules)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse rules for site '%s'", site)
+		}
+		err = siteRules.Titles.compile()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse title rules for site '%s'", site)
+		}
+		rules[strings.ToLower(site)] = siteRules
+	}
+
+	return rules, nil
+}
+
+// ForHost returns the rules for the hostname, or the defaults when no site
+// matches it.
+func (s SiteRuleSet) ForHost(host string) *SiteRules {
+	sites := make([]string, 0, len(s))
+	for site := range s {
+		sites = append(sites, site)
+	}
+	if site, ok := util.MatchSite(sites, host); ok {
+		return s[site]
+	}
+
+	return DefaultSiteRules()
+}
@@ -0,0 +1,216 @@
+package crawl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	log "github.com/unchartedsoftware/plog"
+)
+
+const (
+	resultExtension = ".json"
+
+	resultDirMode  = 0755
+	resultFileMode = 0644
+)
+
+var (
+	// ErrNotFound is returned when a stored crawl does not exist.
+	ErrNotFound = errors.New("crawl not found")
+)
+
+// Metadata describes a finished crawl.
+type Metadata struct {
+	ID           string    `json:"id"`
+	URL          string    `json:"url"`
+	StartTime    time.Time `json:"startTime"`
+	EndTime      time.Time `json:"endTime"`
+	PageCount    int       `json:"pageCount"`
+	LimitReached string    `json:"limitReached,omitempty"`
+	IDs          string    `json:"ids,omitempty"`
+}
+
+// Result is a finished crawl. The graph is stored as its propositions, each
+// linked to the page it was discovered from through the parent url, along with
+// every link found between the pages.
+type Result struct {
+	Metadata     *Metadata      `json:"metadata"`
+	Propositions []*Proposition `json:"propositions"`
+	Links        []*Link        `json:"links"`
+}
+
+// Store persists crawl results.
+type Store interface {
+	Save(result *Result) error
+	Load(id string) (*Result, error)
+	List() ([]*Metadata, error)
+	Delete(id string) error
+}
+
+// FileStore is a store that writes each crawl result to its own JSON file.
+type FileStore struct {
+	dir  string
+	lock *sync.RWMutex
+}
+
+// NewFileStore creates a file store rooted at the given directory.
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, resultDirMode)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create crawl store directory '%s'", dir)
+	}
+
+	return &FileStore{
+		dir:  dir,
+		lock: &sync.RWMutex{},
+	}, nil
+}
+
+// Save writes the crawl result, replacing any result with the same id.
+func (s *FileStore) Save(result *Result) error {
+	filename, err := s.filename(result.Metadata.ID)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := json.Marshal(result)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal crawl result")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// write to a temp file first so a failed write never leaves a partial result
+	tmpFilename := filename + ".tmp"
+	err = ioutil.WriteFile(tmpFilename, bytes, resultFileMode)
+	if err != nil {
+		return errors.Wrap(err, "unable to write crawl result")
+	}
+	err = os.Rename(tmpFilename, filename)
+	if err != nil {
+		return errors.Wrap(err, "unable to move crawl result into place")
+	}
+	log.Infof("stored crawl %s of site '%s'", result.Metadata.ID, result.Metadata.URL)
+
+	return nil
+}
+
+// Load reads the crawl result with the given id.
+func (s *FileStore) Load(id string) (*Result, error) {
+	filename, err := s.filename(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return readResult(filename)
+}
+
+// List returns the metadata of every stored crawl, newest first. Results that
+// cannot be read are logged and left out.
+func (s *FileStore) List() ([]*Metadata, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read crawl store directory")
+	}
+
+	metadata := []*Metadata{}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), resultExtension) {
+			continue
+		}
+		m, err := readMetadata(path.Join(s.dir, f.Name()))
+		if err != nil {
+			log.Warnf("skipping crawl result '%s': %v", f.Name(), err)
+			continue
+		}
+		metadata = append(metadata, m)
+	}
+	sort.Slice(metadata, func(i, j int) bool {
+		return metadata[i].StartTime.After(metadata[j].StartTime)
+	})
+
+	return metadata, nil
+}
+
+// Delete removes the crawl result with the given id.
+func (s *FileStore) Delete(id string) error {
+	filename, err := s.filename(id)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err = os.Remove(filename)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return errors.Wrap(err, "unable to delete crawl result")
+	}
+
+	return nil
+}
+
+func (s *FileStore) filename(id string) (string, error) {
+	// ids are always uuids which also keeps them from escaping the directory
+	if _, err := uuid.FromString(id); err != nil {
+		return "", ErrNotFound
+	}
+
+	return path.Join(s.dir, id+resultExtension), nil
+}
+
+func readResult(filename string) (*Result, error) {
+	bytes, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, errors.Wrap(err, "unable to read crawl result")
+	}
+
+	result := &Result{}
+	err = json.Unmarshal(bytes, result)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse crawl result '%s'", filename)
+	}
+
+	return result, nil
+}
+
+// readMetadata reads only the metadata of the crawl result, leaving the
+// propositions and links undecoded.
+func readMetadata(filename string) (*Metadata, error) {
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read crawl result")
+	}
+
+	result := &struct {
+		Metadata *Metadata `json:"metadata"`
+	}{}
+	err = json.Unmarshal(bytes, result)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse crawl result '%s'", filename)
+	}
+	if result.Metadata == nil {
+		return nil, errors.Errorf("crawl result '%s' has no metadata", filename)
+	}
+
+	return result.Metadata, nil
+}
@@ -0,0 +1,70 @@
+package crawl
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawl-store")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	store, err := NewFileStore(path.Join(dir, "crawls"))
+	if err != nil {
+		t.Fatalf("unable to create store: %v", err)
+	}
+
+	older := &Metadata{ID: "2c0f2c5e-7f43-4c2e-9a55-8d3a1c8b1f01", URL: "http://example.com/", StartTime: time.Now().Add(-time.Hour)}
+	newer := &Metadata{ID: "7a1d7b1e-0c7e-4a57-b0b3-3f6f1a6f2d02", URL: "http://example.com/", StartTime: time.Now()}
+	for _, m := range []*Metadata{older, newer} {
+		err = store.Save(&Result{Metadata: m, Propositions: []*Proposition{{URL: m.URL}}})
+		if err != nil {
+			t.Fatalf("unable to save result: %v", err)
+		}
+	}
+
+	info, err := os.Stat(store.dir)
+	if err != nil || info.Mode().Perm() != resultDirMode {
+		t.Errorf("store directory has mode %v, want %v", info.Mode().Perm(), os.FileMode(resultDirMode))
+	}
+	filename, _ := store.filename(newer.ID)
+	info, err = os.Stat(filename)
+	if err != nil || info.Mode().Perm() != resultFileMode {
+		t.Errorf("stored result has mode %v, want %v", info.Mode().Perm(), os.FileMode(resultFileMode))
+	}
+
+	// unreadable results are left out of the listing rather than failing it
+	for name, contents := range map[string]string{
+		"3b9e6f4a-1d2c-4e8f-a7b6-5c4d3e2f1a03.json": "{not json",
+		"4c8d7e6f-5a4b-4c3d-92e1-0f9e8d7c6b04.json": `{"propositions": []}`,
+	} {
+		err = ioutil.WriteFile(path.Join(store.dir, name), []byte(contents), resultFileMode)
+		if err != nil {
+			t.Fatalf("unable to write result: %v", err)
+		}
+	}
+	metadata, err := store.List()
+	if err != nil {
+		t.Fatalf("unable to list results: %v", err)
+	}
+	if len(metadata) != 2 || metadata[0].ID != newer.ID || metadata[1].ID != older.ID {
+		t.Errorf("got %d results, want the newer and then the older result", len(metadata))
+	}
+
+	result, err := store.Load(older.ID)
+	if err != nil || len(result.Propositions) != 1 {
+		t.Errorf("unable to load result: %v", err)
+	}
+	err = store.Delete(older.ID)
+	if err != nil {
+		t.Errorf("unable to delete result: %v", err)
+	}
+	if _, err = store.Load(older.ID); err != ErrNotFound {
+		t.Errorf("got %v loading a deleted result, want not found", err)
+	}
+}
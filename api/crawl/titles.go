@@ -0,0 +1,230 @@
+package crawl
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultTitleMinShare = 0.5
+	maxTitleRounds       = 3
+)
+
+var (
+	defaultTitleSeparators = []string{"||", "|", "::", "-", "–", "—", "»", "·"}
+)
+
+// TitleRules controls how page tags are cleaned of the site branding.
+type TitleRules struct {
+	// Learn strips the title segments that start or end most titles across
+	// the crawl.
+	Learn bool `json:"learn"`
+	// Separators split titles into segments. Separators other than '|' and
+	// ':' runs need whitespace on both sides so hyphenated words stay whole.
+	Separators []string `json:"separators"`
+	// MinShare is the share of segmented titles a segment must start or end
+	// to be stripped.
+	MinShare float64 `json:"minShare"`
+	// Rewrites are applied to every tag, in order, before learning.
+	Rewrites []*TitleRewrite `json:"rewrites"`
+
+	separator *regexp.Regexp
+}
+
+// TitleRewrite replaces the matches of a regular expression in a tag.
+type TitleRewrite struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+
+	regex *regexp.Regexp
+}
+
+// DefaultTitleRules returns the rules used when a site has none of its own.
+func DefaultTitleRules() *TitleRules {
+	rules := &TitleRules{
+		Learn:      true,
+		Separators: append([]string{}, defaultTitleSeparators...),
+		MinShare:   defaultTitleMinShare,
+		Rewrites:   []*TitleRewrite{},
+	}
+	rules.compile()
+
+	return rules
+}
+
+// compile prepares the separator and rewrite expressions.
+func (r *TitleRules) compile() error {
+	if r == nil {
+		return nil
+	}
+
+	for _, rewrite := range r.Rewrites {
+		regex, err := regexp.Compile(rewrite.Pattern)
+		if err != nil {
+			return errors.Wrapf(err, "unable to compile title rewrite '%s'", rewrite.Pattern)
+		}
+		rewrite.regex = regex
+	}
+
+	// longer separators go first so '||' is not read as two '|'
+	separators := append([]string{}, r.Separators...)
+	sort.SliceStable(separators, func(i, j int) bool {
+		return len(separators[i]) > len(separators[j])
+	})
+	alternatives := []string{}
+	for _, s := range separators {
+		if s == "" {
+			continue
+		}
+		if strings.Trim(s, "|:") == "" {
+			alternatives = append(alternatives, `\s*`+regexp.QuoteMeta(s)+`\s*`)
+		} else {
+			alternatives = append(alternatives, `\s+`+regexp.QuoteMeta(s)+`\s+`)
+		}
+	}
+	r.separator = nil
+	if len(alternatives) > 0 {
+		r.separator = regexp.MustCompile(strings.Join(alternatives, "|"))
+	}
+
+	return nil
+}
+
+// normalise rewrites the tags of the propositions and strips the site wide
+// title segments, keeping the original tag among the potential tags.
+func (r *TitleRules) normalise(propositions []*Proposition) {
+	if r == nil || len(propositions) == 0 {
+		return
+	}
+
+	titles := make([]*segmentedTitle, len(propositions))
+	for i, p := range propositions {
+		tag := p.Tag
+		for _, rewrite := range r.Rewrites {
+			if rewrite.regex != nil {
+				tag = cleanLabel(rewrite.regex.ReplaceAllString(tag, rewrite.Replace))
+			}
+		}
+		titles[i] = r.segment(tag)
+	}
+
+	if r.Learn && r.separator != nil {
+		for round := 0; round < maxTitleRounds; round++ {
+			if !r.stripCommon(titles) {
+				break
+			}
+		}
+	}
+
+	for i, p := range propositions {
+		tag := titles[i].String()
+		if tag == "" || tag == p.Tag {
+			continue
+		}
+		p.Tag = tag
+		if !containsString(p.PotentialTags, tag) {
+			p.PotentialTags = append(p.PotentialTags, tag)
+		}
+	}
+}
+
+// stripCommon removes the first and last segments shared by enough titles,
+// returning whether any title changed.
+func (r *TitleRules) stripCommon(titles []*segmentedTitle) bool {
+	prefixes := map[string]int{}
+	suffixes := map[string]int{}
+	segmented := 0
+	for _, t := range titles {
+		if t.length() < 2 {
+			continue
+		}
+		segmented++
+		prefixes[t.first()]++
+		suffixes[t.last()]++
+	}
+
+	common := func(count int) bool {
+		return count >= 2 && float64(count) >= r.MinShare*float64(segmented)
+	}
+	changed := false
+	for _, t := range titles {
+		// a title is never stripped of its last segment
+		if t.length() >= 2 && common(prefixes[t.first()]) {
+			t.start++
+			changed = true
+		}
+		if t.length() >= 2 && common(suffixes[t.last()]) {
+			t.end--
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// segmentedTitle is a title split into segments, of which those from start up
+// to end are kept.
+type segmentedTitle struct {
+	title    string
+	segments [][]int
+	start    int
+	end      int
+}
+
+func (r *TitleRules) segment(title string) *segmentedTitle {
+	segments := [][]int{}
+	previous := 0
+	if r.separator != nil {
+		for _, match := range r.separator.FindAllStringIndex(title, -1) {
+			if match[0] > previous {
+				segments = append(segments, []int{previous, match[0]})
+			}
+			previous = match[1]
+		}
+	}
+	if previous < len(title) {
+		segments = append(segments, []int{previous, len(title)})
+	}
+
+	return &segmentedTitle{
+		title:    title,
+		segments: segments,
+		end:      len(segments),
+	}
+}
+
+func (t *segmentedTitle) length() int {
+	return t.end - t.start
+}
+
+func (t *segmentedTitle) first() string {
+	s := t.segments[t.start]
+	return t.title[s[0]:s[1]]
+}
+
+func (t *segmentedTitle) last() string {
+	s := t.segments[t.end-1]
+	return t.title[s[0]:s[1]]
+}
+
+// String returns the kept segments with the separators between them.
+func (t *segmentedTitle) String() string {
+	if t.length() < 1 {
+		return ""
+	}
+
+	return strings.TrimSpace(t.title[t.segments[t.start][0]:t.segments[t.end-1][1]])
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,6 +2,7 @@ package env
 
 import (
 	"sync"
+	"time"
 
 	"github.com/caarlos0/env"
 )
@@ -13,8 +14,45 @@ var (
 
 // Config represents the application configuration state loaded from env vars.
 type Config struct {
-	AllowedSitesFile string `env:"ALLOWED_SITES_FILE" envDefault:"allowed-sites.txt"`
-	AppPort          string `env:"PORT" envDefault:"8090"`
+	AllowedSitesFile   string        `env:"ALLOWED_SITES_FILE" envDefault:"allowed-sites.txt"`
+	AllowedSitesReload time.Duration `env:"ALLOWED_SITES_RELOAD" envDefault:"5s"`
+	AppPort            string        `env:"PORT" envDefault:"8090"`
+	AuthKeysFile       string        `env:"AUTH_KEYS_FILE" envDefault:""`
+	AuthJWTSecret      string        `env:"AUTH_JWT_SECRET" envDefault:""`
+	AuthJWKSFile       string        `env:"AUTH_JWKS_FILE" envDefault:""`
+	AuthJWTIssuer      string        `env:"AUTH_JWT_ISSUER" envDefault:""`
+	AuthJWTAudience    string        `env:"AUTH_JWT_AUDIENCE" envDefault:""`
+	CrawlStoreDir      string        `env:"CRAWL_STORE_DIR" envDefault:"crawls"`
+	CrawlUserAgent     string        `env:"CRAWL_USER_AGENT" envDefault:"proposition-poc"`
+	CrawlParallelism   int           `env:"CRAWL_PARALLELISM" envDefault:"2"`
+	CrawlDelay         time.Duration `env:"CRAWL_DELAY" envDefault:"250ms"`
+	CrawlRandomDelay   time.Duration `env:"CRAWL_RANDOM_DELAY" envDefault:"250ms"`
+	CrawlRespectRobots bool          `env:"CRAWL_RESPECT_ROBOTS" envDefault:"true"`
+	CrawlMaxDepth      int           `env:"CRAWL_MAX_DEPTH" envDefault:"0"`
+	CrawlMaxPages      int           `env:"CRAWL_MAX_PAGES" envDefault:"5000"`
+	CrawlMaxDuration   time.Duration `env:"CRAWL_MAX_DURATION" envDefault:"30m"`
+	CrawlMaxBytes      int64         `env:"CRAWL_MAX_BYTES" envDefault:"0"`
+	CrawlSitemap       string        `env:"CRAWL_SITEMAP" envDefault:""`
+	CrawlLabels        []string      `env:"CRAWL_LABELS" envDefault:"title,og:title,h1,breadcrumb,aria-label,anchor" envSeparator:","`
+	CrawlLabelRule     string        `env:"CRAWL_LABEL_RULE" envDefault:"first"`
+	CrawlAllowNetworks []string      `env:"CRAWL_ALLOW_NETWORKS" envDefault:"" envSeparator:","`
+	CrawlCacheTTL      time.Duration `env:"CRAWL_CACHE_TTL" envDefault:"10m"`
+	CrawlCacheSize     int           `env:"CRAWL_CACHE_SIZE" envDefault:"100"`
+	CrawlJobTTL        time.Duration `env:"CRAWL_JOB_TTL" envDefault:"1h"`
+	PageCacheDir       string        `env:"PAGE_CACHE_DIR" envDefault:"page-cache"`
+	PageCacheMaxAge    time.Duration `env:"PAGE_CACHE_MAX_AGE" envDefault:"168h"`
+	PageCacheMaxSize   int64         `env:"PAGE_CACHE_MAX_SIZE" envDefault:"536870912"`
+	PropositionIDs     string        `env:"PROPOSITION_IDS" envDefault:"url"`
+	QuotaConcurrent    int           `env:"QUOTA_CONCURRENT" envDefault:"8"`
+	QuotaHourlyCrawls  int           `env:"QUOTA_HOURLY_CRAWLS" envDefault:"0"`
+	QuotaDailyPages    int           `env:"QUOTA_DAILY_PAGES" envDefault:"0"`
+	ClientConcurrent   int           `env:"QUOTA_CLIENT_CONCURRENT" envDefault:"2"`
+	ClientHourlyCrawls int           `env:"QUOTA_CLIENT_HOURLY_CRAWLS" envDefault:"0"`
+	ClientDailyPages   int           `env:"QUOTA_CLIENT_DAILY_PAGES" envDefault:"0"`
+	RenderMaxDepth     int           `env:"RENDER_MAX_DEPTH" envDefault:"20"`
+	RouteCrawlTimeout  time.Duration `env:"ROUTE_CRAWL_TIMEOUT" envDefault:"5m"`
+	VerboseErrors      bool          `env:"VERBOSE_ERRORS" envDefault:"false"`
+	SiteRulesFile      string        `env:"SITE_RULES_FILE" envDefault:""`
 }
 
 // LoadConfig loads the config from the environment if necessary and returns a copy.
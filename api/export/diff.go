@@ -0,0 +1,87 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+)
+
+const (
+	// DiffFormatJSON writes the changes grouped by kind as JSON.
+	DiffFormatJSON = "json"
+	// DiffFormatCSV writes one CSV row per change.
+	DiffFormatCSV = "csv"
+)
+
+var (
+	diffContentTypes = map[string]string{
+		DiffFormatJSON: "application/json",
+		DiffFormatCSV:  "text/csv",
+	}
+)
+
+// DiffContentType returns the content type of the diff format.
+func DiffContentType(format string) (string, error) {
+	contentType, ok := diffContentTypes[format]
+	if !ok {
+		return "", errors.Errorf("unknown diff format '%s'", format)
+	}
+
+	return contentType, nil
+}
+
+// DiffFilename returns the file name to download the diff as.
+func DiffFilename(format string) string {
+	return "diff." + format
+}
+
+// WriteDiff writes the changes between two crawls in the diff format.
+func WriteDiff(w io.Writer, diff *crawl.GraphDiff, format string) error {
+	var err error
+	switch format {
+	case DiffFormatJSON:
+		err = json.NewEncoder(w).Encode(diff)
+	case DiffFormatCSV:
+		err = writeDiffCSV(w, diff)
+	default:
+		return errors.Errorf("unknown diff format '%s'", format)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "unable to write %s diff", format)
+	}
+
+	return nil
+}
+
+// writeDiffCSV writes a row per change with the default proposition columns
+// followed by the kind of change and what the page was before it: the previous
+// parent url of a moved page and the previous tag of a renamed page.
+func writeDiffCSV(w io.Writer, diff *crawl.GraphDiff) error {
+	csvWriter := csv.NewWriter(w)
+	err := csvWriter.Write(append(columnHeadings(DefaultColumns), "Change", "Previous"))
+	if err != nil {
+		return err
+	}
+
+	for _, change := range diff.Changes() {
+		previous := ""
+		switch change.Change {
+		case crawl.ChangeMoved:
+			previous = change.PreviousParentURL
+		case crawl.ChangeRenamed:
+			previous = change.Previous.Tag
+		}
+		row := propositionRow(change.Proposition, change.ParentURL, 0, DefaultColumns)
+		err = csvWriter.Write(append(row, change.Change, previous))
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+
+	return csvWriter.Error()
+}
@@ -0,0 +1,418 @@
+package export
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+)
+
+const (
+	// GraphFormatJGF is the JSON Graph Format.
+	GraphFormatJGF = "jgf"
+	// GraphFormatGraphML is the GraphML XML format.
+	GraphFormatGraphML = "graphml"
+	// GraphFormatGEXF is the Gephi GEXF XML format.
+	GraphFormatGEXF = "gexf"
+
+	linkRelation = "link"
+)
+
+var (
+	graphContentTypes = map[string]string{
+		GraphFormatJGF:     "application/json",
+		GraphFormatGraphML: "application/graphml+xml",
+		GraphFormatGEXF:    "application/gexf+xml",
+	}
+	graphExtensions = map[string]string{
+		GraphFormatJGF:     "json",
+		GraphFormatGraphML: "graphml",
+		GraphFormatGEXF:    "gexf",
+	}
+)
+
+// GraphContentType returns the content type of the graph format.
+func GraphContentType(format string) (string, error) {
+	contentType, ok := graphContentTypes[format]
+	if !ok {
+		return "", errors.Errorf("unknown graph format '%s'", format)
+	}
+
+	return contentType, nil
+}
+
+// GraphFilename returns the file name to download the graph as.
+func GraphFilename(format string) string {
+	return fmt.Sprintf("linkgraph.%s", graphExtensions[format])
+}
+
+// graphNode is a page in the link graph. Pages that were linked to but not
+// crawled, such as those beyond the crawl limits, are included so no link
+// points at a missing node.
+type graphNode struct {
+	id          string
+	url         string
+	label       string
+	crawled     bool
+	proposition *crawl.Proposition
+}
+
+type linkGraph struct {
+	url   string
+	nodes []*graphNode
+	links []*crawl.Link
+	ids   map[string]string
+}
+
+func newLinkGraph(result *crawl.Result) *linkGraph {
+	g := &linkGraph{
+		nodes: []*graphNode{},
+		links: result.Links,
+		ids:   map[string]string{},
+	}
+	if result.Metadata != nil {
+		g.url = result.Metadata.URL
+	}
+
+	add := func(url string, p *crawl.Proposition) {
+		if _, ok := g.ids[url]; ok {
+			return
+		}
+		node := &graphNode{
+			id:          fmt.Sprintf("n%d", len(g.nodes)),
+			url:         url,
+			label:       url,
+			crawled:     p != nil,
+			proposition: p,
+		}
+		if p != nil && p.Tag != "" {
+			node.label = p.Tag
+		}
+		g.ids[url] = node.id
+		g.nodes = append(g.nodes, node)
+	}
+	for _, p := range result.Propositions {
+		add(p.URL, p)
+	}
+	for _, l := range result.Links {
+		add(l.Source, nil)
+		add(l.Target, nil)
+	}
+
+	return g
+}
+
+// WriteLinkGraph writes every page of the crawl and every link between them
+// in the graph format.
+func WriteLinkGraph(w io.Writer, result *crawl.Result, format string) error {
+	g := newLinkGraph(result)
+
+	var err error
+	switch format {
+	case GraphFormatJGF:
+		err = g.writeJGF(w)
+	case GraphFormatGraphML:
+		err = g.writeGraphML(w)
+	case GraphFormatGEXF:
+		err = g.writeGEXF(w)
+	default:
+		return errors.Errorf("unknown graph format '%s'", format)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "unable to write %s link graph", format)
+	}
+
+	return nil
+}
+
+type jgfDocument struct {
+	Graph *jgfGraph `json:"graph"`
+}
+
+type jgfGraph struct {
+	Label    string              `json:"label,omitempty"`
+	Directed bool                `json:"directed"`
+	Type     string              `json:"type"`
+	Nodes    map[string]*jgfNode `json:"nodes"`
+	Edges    []*jgfEdge          `json:"edges"`
+}
+
+type jgfNode struct {
+	Label    string                 `json:"label"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+type jgfEdge struct {
+	Source   string                 `json:"source"`
+	Target   string                 `json:"target"`
+	Relation string                 `json:"relation"`
+	Directed bool                   `json:"directed"`
+	Label    string                 `json:"label,omitempty"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// writeJGF writes the graph as JSON Graph Format version 2, keying the nodes
+// by url.
+func (g *linkGraph) writeJGF(w io.Writer) error {
+	graph := &jgfGraph{
+		Label:    g.url,
+		Directed: true,
+		Type:     linkRelation,
+		Nodes:    map[string]*jgfNode{},
+		Edges:    []*jgfEdge{},
+	}
+	for _, n := range g.nodes {
+		metadata := map[string]interface{}{
+			"url":     n.url,
+			"crawled": n.crawled,
+		}
+		if n.proposition != nil {
+			metadata["id"] = n.proposition.ID
+			metadata["parentUrl"] = n.proposition.ParentURL
+			if len(n.proposition.Aliases) > 0 {
+				metadata["aliases"] = n.proposition.Aliases
+			}
+		}
+		graph.Nodes[n.url] = &jgfNode{
+			Label:    n.label,
+			Metadata: metadata,
+		}
+	}
+	for _, l := range g.links {
+		metadata := map[string]interface{}{
+			"position": l.Position,
+			"index":    l.Index,
+		}
+		if len(l.Rel) > 0 {
+			metadata["rel"] = l.Rel
+		}
+		graph.Edges = append(graph.Edges, &jgfEdge{
+			Source:   l.Source,
+			Target:   l.Target,
+			Relation: linkRelation,
+			Directed: true,
+			Label:    l.Text,
+			Metadata: metadata,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(&jgfDocument{Graph: graph})
+}
+
+type graphmlDocument struct {
+	XMLName xml.Name      `xml:"graphml"`
+	XMLNS   string        `xml:"xmlns,attr"`
+	Keys    []*graphmlKey `xml:"key"`
+	Graph   *graphmlGraph `xml:"graph"`
+}
+
+type graphmlKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphmlGraph struct {
+	ID          string         `xml:"id,attr"`
+	EdgeDefault string         `xml:"edgedefault,attr"`
+	Nodes       []*graphmlNode `xml:"node"`
+	Edges       []*graphmlEdge `xml:"edge"`
+}
+
+type graphmlNode struct {
+	ID   string         `xml:"id,attr"`
+	Data []*graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	ID     string         `xml:"id,attr"`
+	Source string         `xml:"source,attr"`
+	Target string         `xml:"target,attr"`
+	Data   []*graphmlData `xml:"data"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (g *linkGraph) writeGraphML(w io.Writer) error {
+	doc := &graphmlDocument{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []*graphmlKey{
+			{ID: "label", For: "node", AttrName: "label", AttrType: "string"},
+			{ID: "url", For: "node", AttrName: "url", AttrType: "string"},
+			{ID: "crawled", For: "node", AttrName: "crawled", AttrType: "boolean"},
+			{ID: "aliases", For: "node", AttrName: "aliases", AttrType: "string"},
+			{ID: "text", For: "edge", AttrName: "text", AttrType: "string"},
+			{ID: "rel", For: "edge", AttrName: "rel", AttrType: "string"},
+			{ID: "position", For: "edge", AttrName: "position", AttrType: "string"},
+			{ID: "index", For: "edge", AttrName: "index", AttrType: "int"},
+		},
+		Graph: &graphmlGraph{
+			ID:          linkRelation,
+			EdgeDefault: "directed",
+			Nodes:       []*graphmlNode{},
+			Edges:       []*graphmlEdge{},
+		},
+	}
+	for _, n := range g.nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, &graphmlNode{
+			ID: n.id,
+			Data: []*graphmlData{
+				{Key: "label", Value: n.label},
+				{Key: "url", Value: n.url},
+				{Key: "crawled", Value: fmt.Sprintf("%t", n.crawled)},
+				{Key: "aliases", Value: n.aliases()},
+			},
+		})
+	}
+	for i, l := range g.links {
+		doc.Graph.Edges = append(doc.Graph.Edges, &graphmlEdge{
+			ID:     fmt.Sprintf("e%d", i),
+			Source: g.ids[l.Source],
+			Target: g.ids[l.Target],
+			Data: []*graphmlData{
+				{Key: "text", Value: l.Text},
+				{Key: "rel", Value: strings.Join(l.Rel, " ")},
+				{Key: "position", Value: l.Position},
+				{Key: "index", Value: fmt.Sprintf("%d", l.Index)},
+			},
+		})
+	}
+
+	return writeXML(w, doc)
+}
+
+type gexfDocument struct {
+	XMLName xml.Name   `xml:"gexf"`
+	XMLNS   string     `xml:"xmlns,attr"`
+	Version string     `xml:"version,attr"`
+	Graph   *gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string            `xml:"defaultedgetype,attr"`
+	Mode            string            `xml:"mode,attr"`
+	Attributes      []*gexfAttributes `xml:"attributes"`
+	Nodes           []*gexfNode       `xml:"nodes>node"`
+	Edges           []*gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string           `xml:"class,attr"`
+	Attributes []*gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	ID        string          `xml:"id,attr"`
+	Label     string          `xml:"label,attr"`
+	AttValues []*gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID        string          `xml:"id,attr"`
+	Source    string          `xml:"source,attr"`
+	Target    string          `xml:"target,attr"`
+	Label     string          `xml:"label,attr,omitempty"`
+	AttValues []*gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+func (g *linkGraph) writeGEXF(w io.Writer) error {
+	graph := &gexfGraph{
+		DefaultEdgeType: "directed",
+		Mode:            "static",
+		Attributes: []*gexfAttributes{
+			{
+				Class: "node",
+				Attributes: []*gexfAttribute{
+					{ID: "url", Title: "url", Type: "string"},
+					{ID: "crawled", Title: "crawled", Type: "boolean"},
+					{ID: "aliases", Title: "aliases", Type: "string"},
+				},
+			},
+			{
+				Class: "edge",
+				Attributes: []*gexfAttribute{
+					{ID: "rel", Title: "rel", Type: "string"},
+					{ID: "position", Title: "position", Type: "string"},
+					{ID: "index", Title: "index", Type: "integer"},
+				},
+			},
+		},
+		Nodes: []*gexfNode{},
+		Edges: []*gexfEdge{},
+	}
+	for _, n := range g.nodes {
+		graph.Nodes = append(graph.Nodes, &gexfNode{
+			ID:    n.id,
+			Label: n.label,
+			AttValues: []*gexfAttValue{
+				{For: "url", Value: n.url},
+				{For: "crawled", Value: fmt.Sprintf("%t", n.crawled)},
+				{For: "aliases", Value: n.aliases()},
+			},
+		})
+	}
+	for i, l := range g.links {
+		graph.Edges = append(graph.Edges, &gexfEdge{
+			ID:     fmt.Sprintf("e%d", i),
+			Source: g.ids[l.Source],
+			Target: g.ids[l.Target],
+			Label:  l.Text,
+			AttValues: []*gexfAttValue{
+				{For: "rel", Value: strings.Join(l.Rel, " ")},
+				{For: "position", Value: l.Position},
+				{For: "index", Value: fmt.Sprintf("%d", l.Index)},
+			},
+		})
+	}
+
+	return writeXML(w, &gexfDocument{
+		XMLNS:   "http://gexf.net/1.3",
+		Version: "1.3",
+		Graph:   graph,
+	})
+}
+
+func (n *graphNode) aliases() string {
+	if n.proposition == nil {
+		return ""
+	}
+
+	return strings.Join(n.proposition.Aliases, " ")
+}
+
+func writeXML(w io.Writer, doc interface{}) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(doc)
+	if err != nil {
+		return err
+	}
+
+	return encoder.Flush()
+}
@@ -0,0 +1,211 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+)
+
+const (
+	// ColumnID is the proposition id.
+	ColumnID = "id"
+	// ColumnFullName is the names of the pages down to the proposition.
+	ColumnFullName = "fullName"
+	// ColumnTag is the proposition name.
+	ColumnTag = "tag"
+	// ColumnCode is the proposition code.
+	ColumnCode = "code"
+	// ColumnURL is the url of the proposition page.
+	ColumnURL = "url"
+	// ColumnParentURL is the url of the page above the proposition in the
+	// hierarchy.
+	ColumnParentURL = "parentUrl"
+	// ColumnPotentialTags is every label found for the proposition.
+	ColumnPotentialTags = "potentialTags"
+	// ColumnDepth is the number of pages above the proposition in the
+	// hierarchy, the site root being at depth 0.
+	ColumnDepth = "depth"
+
+	potentialTagSeparator = "; "
+	byteOrderMark         = "\ufeff"
+)
+
+var (
+	// DefaultColumns are the columns of the original proposition CSV.
+	DefaultColumns = []string{ColumnID, ColumnFullName, ColumnTag, ColumnCode, ColumnURL}
+
+	columnHeaders = map[string]string{
+		ColumnID:            "Proposition ID",
+		ColumnFullName:      "Proposition Full Name",
+		ColumnTag:           "Proposition",
+		ColumnCode:          "Proposition Code",
+		ColumnURL:           "URL",
+		ColumnParentURL:     "Parent URL",
+		ColumnPotentialTags: "Potential Propositions",
+		ColumnDepth:         "Depth",
+	}
+)
+
+// CSVOptions configures the proposition CSV.
+type CSVOptions struct {
+	// Columns lists the columns to write in order, the default columns being
+	// written when it is empty.
+	Columns []string
+	// Delimiter separates the fields, a comma being used when it is empty.
+	Delimiter string
+	// BOM starts the file with a byte order mark so Excel reads it as UTF-8.
+	BOM bool
+}
+
+// Validate checks the columns and delimiter are supported.
+func (o *CSVOptions) Validate() error {
+	err := ValidateColumns(o.Columns)
+	if err != nil {
+		return err
+	}
+
+	return ValidateDelimiter(o.Delimiter)
+}
+
+// ValidateColumns checks every column is a known column.
+func ValidateColumns(columns []string) error {
+	for _, column := range columns {
+		if _, ok := columnHeaders[column]; !ok {
+			return errors.Errorf("unknown column '%s'", column)
+		}
+	}
+
+	return nil
+}
+
+// ValidateDelimiter checks the delimiter is empty or a single character other
+// than a quote or line break.
+func ValidateDelimiter(delimiter string) error {
+	if delimiter == "" {
+		return nil
+	}
+
+	r, size := utf8.DecodeRuneInString(delimiter)
+	if size != len(delimiter) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return errors.Errorf("delimiter '%s' must be a single character other than a quote or line break", delimiter)
+	}
+
+	return nil
+}
+
+// columnHeadings returns the headers of the columns.
+func columnHeadings(columns []string) []string {
+	headings := make([]string, len(columns))
+	for i, column := range columns {
+		headings[i] = columnHeaders[column]
+	}
+
+	return headings
+}
+
+// WritePropositionsCSV writes a row for every proposition in the graph, parents
+// before their children.
+func WritePropositionsCSV(w io.Writer, graph *crawl.Graph, options CSVOptions) error {
+	err := options.Validate()
+	if err != nil {
+		return err
+	}
+	columns := options.Columns
+	if len(columns) == 0 {
+		columns = DefaultColumns
+	}
+
+	if options.BOM {
+		_, err = io.WriteString(w, byteOrderMark)
+		if err != nil {
+			return errors.Wrap(err, "unable to write csv byte order mark")
+		}
+	}
+
+	csvWriter := csv.NewWriter(w)
+	if options.Delimiter != "" {
+		csvWriter.Comma, _ = utf8.DecodeRuneInString(options.Delimiter)
+	}
+	err = csvWriter.Write(columnHeadings(columns))
+	if err != nil {
+		return errors.Wrap(err, "unable to write csv header")
+	}
+
+	for _, row := range graphRows(graph) {
+		err = csvWriter.Write(propositionRow(row.proposition, row.parent, row.depth(), columns))
+		if err != nil {
+			return errors.Wrap(err, "unable to write csv row")
+		}
+	}
+	csvWriter.Flush()
+
+	return errors.Wrap(csvWriter.Error(), "unable to write csv data")
+}
+
+// graphRow is a proposition along with its place in the graph.
+type graphRow struct {
+	proposition *crawl.Proposition
+	parent      string
+	// path holds the propositions from the top of the graph down to and
+	// including the proposition.
+	path []*crawl.Proposition
+}
+
+func (r *graphRow) depth() int {
+	return len(r.path) - 1
+}
+
+// graphRows returns every proposition in the graph below the empty root,
+// parents before their children.
+func graphRows(graph *crawl.Graph) []*graphRow {
+	rows := []*graphRow{}
+	if graph == nil || graph.Root == nil {
+		return rows
+	}
+
+	var walk func(node *crawl.Node, parent string, path []*crawl.Proposition)
+	walk = func(node *crawl.Node, parent string, path []*crawl.Proposition) {
+		if node.Key != "" {
+			path = append(path[:len(path):len(path)], node.Data)
+			rows = append(rows, &graphRow{node.Data, parent, path})
+		}
+		for _, child := range node.Neighbours {
+			walk(child, node.Key, path)
+		}
+	}
+	walk(graph.Root, "", []*crawl.Proposition{})
+
+	return rows
+}
+
+func propositionRow(p *crawl.Proposition, parent string, depth int, columns []string) []string {
+	row := make([]string, len(columns))
+	for i, column := range columns {
+		switch column {
+		case ColumnID:
+			row[i] = p.ID
+		case ColumnFullName:
+			row[i] = p.FullName
+		case ColumnTag:
+			row[i] = p.Tag
+		case ColumnCode:
+			row[i] = p.Code
+		case ColumnURL:
+			row[i] = p.URL
+		case ColumnParentURL:
+			row[i] = parent
+		case ColumnPotentialTags:
+			row[i] = strings.Join(p.PotentialTags, potentialTagSeparator)
+		case ColumnDepth:
+			row[i] = fmt.Sprintf("%d", depth)
+		}
+	}
+
+	return row
+}
@@ -0,0 +1,109 @@
+package export
+
+import (
+	"fmt"
+
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+)
+
+// TreemapItem is a transformed graph to match the expected treemap structure.
+type TreemapItem struct {
+	Children []*TreemapItem `json:"children"`
+	Name     string         `json:"name"`
+	ColName  string         `json:"colname,omitempty"`
+	Code     string         `json:"code,omitempty"`
+	Value    int            `json:"value,omitempty"`
+}
+
+// BuildTreemap arranges the graph below the site root into the treemap
+// structure, down to the max depth.
+func BuildTreemap(graph *crawl.Graph, maxDepth int) *TreemapItem {
+	if graph.Root == nil || len(graph.Root.Neighbours) == 0 {
+		return &TreemapItem{Children: []*TreemapItem{}}
+	}
+
+	return nodeToItem(maxDepth, 1, graph.Root.Neighbours[0])
+}
+
+func nodeToItem(maxDepth int, depth int, node *crawl.Node) *TreemapItem {
+	colName := ""
+	if depth > 1 {
+		colName = fmt.Sprintf("%s%d", levelColumnPrefix, depth)
+	}
+	item := &TreemapItem{
+		Name:     node.Data.Tag,
+		ColName:  colName,
+		Code:     node.Data.Code,
+		Children: []*TreemapItem{},
+	}
+
+	if depth < maxDepth {
+		for _, c := range node.Neighbours {
+			item.Children = append(item.Children, nodeToItem(maxDepth, depth+1, c))
+		}
+	}
+
+	if len(item.Children) == 0 {
+		item.Value = 1
+	}
+
+	return item
+}
+
+// TreeGraphItem is an item in the treegraph structure.
+type TreeGraphItem struct {
+	ID    string `json:"id"`
+	Code  string `json:"code,omitempty"`
+	Value int    `json:"value,omitempty"`
+}
+
+// TreeGraph is a transformed graph to match the expected treegraph structure.
+type TreeGraph struct {
+	Items []*TreeGraphItem `json:"items"`
+}
+
+// BuildTreeGraph arranges the graph into the treegraph structure, down to the
+// max depth. Each item is identified by the names of the pages down to it,
+// starting from a home item above the site root.
+func BuildTreeGraph(graph *crawl.Graph, maxDepth int) *TreeGraph {
+	if graph.Root == nil {
+		return &TreeGraph{Items: []*TreeGraphItem{}}
+	}
+
+	root := graph.Root
+	root.Key = graph.URL
+	root.Data = &crawl.Proposition{
+		URL:      graph.URL,
+		ID:       graph.URL,
+		FullName: "HOME.",
+	}
+	crawl.AssignFullNames(root, ".")
+
+	return &TreeGraph{nodeToGraphItem(map[string]bool{}, maxDepth, 1, root)}
+}
+
+func nodeToGraphItem(ids map[string]bool, maxDepth int, depth int, node *crawl.Node) []*TreeGraphItem {
+	item := &TreeGraphItem{
+		ID:   node.Data.FullName[:len(node.Data.FullName)-1],
+		Code: node.Data.Code,
+	}
+
+	items := []*TreeGraphItem{}
+	if !ids[node.Data.FullName] {
+		items = append(items, item)
+		ids[node.Data.FullName] = true
+	}
+
+	if len(node.Neighbours) == 0 {
+		item.Value = 1
+	}
+
+	children := []*TreeGraphItem{}
+	if depth < maxDepth {
+		for _, c := range node.Neighbours {
+			children = append(children, nodeToGraphItem(ids, maxDepth, depth+1, c)...)
+		}
+	}
+
+	return append(items, children...)
+}
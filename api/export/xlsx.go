@@ -0,0 +1,305 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+)
+
+const (
+	// XLSXContentType is the content type of an Excel workbook.
+	XLSXContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+	levelColumnPrefix = "level"
+
+	spreadsheetNS   = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	relationshipsNS = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	packageRelNS    = "http://schemas.openxmlformats.org/package/2006/relationships"
+	contentTypesNS  = "http://schemas.openxmlformats.org/package/2006/content-types"
+	officeDocRel    = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument"
+	worksheetRel    = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet"
+	workbookType    = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"
+	worksheetType   = "application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"
+	relsType        = "application/vnd.openxmlformats-package.relationships+xml"
+)
+
+var (
+	// rawColumns are the columns of the raw propositions sheet, the depth
+	// last so it can be written as a number.
+	rawColumns = []string{ColumnID, ColumnFullName, ColumnTag, ColumnCode, ColumnURL, ColumnParentURL, ColumnPotentialTags, ColumnDepth}
+)
+
+// sheet is a worksheet of string cells, except for the cells holding numbers.
+type sheet struct {
+	name string
+	rows [][]interface{}
+}
+
+// WriteXLSX writes the propositions of the graph as an Excel workbook with
+// three sheets: the propositions flattened into a column per level of the
+// hierarchy, the raw propositions and the crawl metadata.
+func WriteXLSX(w io.Writer, graph *crawl.Graph, metadata *crawl.Metadata) error {
+	rows := graphRows(graph)
+	sheets := []*sheet{
+		levelSheet(rows),
+		rawSheet(rows),
+		metadataSheet(graph, metadata),
+	}
+
+	archive := zip.NewWriter(w)
+	err := writeWorkbook(archive, sheets)
+	if err != nil {
+		return errors.Wrap(err, "unable to write xlsx workbook")
+	}
+
+	return errors.Wrap(archive.Close(), "unable to write xlsx workbook")
+}
+
+// levelSheet flattens the hierarchy into a row per proposition, with the tags
+// of the pages down to it in the level columns. The levels are numbered as the
+// treemap columns are, the top of the hierarchy being level 1.
+func levelSheet(rows []*graphRow) *sheet {
+	levels := 0
+	for _, row := range rows {
+		if len(row.path) > levels {
+			levels = len(row.path)
+		}
+	}
+
+	header := []interface{}{}
+	for level := 1; level <= levels; level++ {
+		header = append(header, fmt.Sprintf("%s%d", levelColumnPrefix, level))
+	}
+	for _, heading := range columnHeadings([]string{ColumnID, ColumnCode, ColumnURL}) {
+		header = append(header, heading)
+	}
+
+	s := &sheet{name: "Levels", rows: [][]interface{}{header}}
+	for _, row := range rows {
+		cells := make([]interface{}, levels, levels+3)
+		for i := range cells {
+			cells[i] = ""
+		}
+		for i, p := range row.path {
+			cells[i] = p.Tag
+		}
+		cells = append(cells, row.proposition.ID, row.proposition.Code, row.proposition.URL)
+		s.rows = append(s.rows, cells)
+	}
+
+	return s
+}
+
+func rawSheet(rows []*graphRow) *sheet {
+	header := []interface{}{}
+	for _, heading := range columnHeadings(rawColumns) {
+		header = append(header, heading)
+	}
+
+	s := &sheet{name: "Propositions", rows: [][]interface{}{header}}
+	for _, row := range rows {
+		cells := []interface{}{}
+		for _, value := range propositionRow(row.proposition, row.parent, row.depth(), rawColumns[:len(rawColumns)-1]) {
+			cells = append(cells, value)
+		}
+		s.rows = append(s.rows, append(cells, row.depth()))
+	}
+
+	return s
+}
+
+func metadataSheet(graph *crawl.Graph, metadata *crawl.Metadata) *sheet {
+	s := &sheet{name: "Crawl", rows: [][]interface{}{{"Property", "Value"}}}
+	add := func(property string, value interface{}) {
+		s.rows = append(s.rows, []interface{}{property, value})
+	}
+
+	add("URL", graph.URL)
+	if metadata != nil {
+		add("Crawl ID", metadata.ID)
+		add("Start Time", metadata.StartTime.Format(time.RFC3339))
+		add("End Time", metadata.EndTime.Format(time.RFC3339))
+		add("Page Count", metadata.PageCount)
+		add("Limit Reached", metadata.LimitReached)
+		add("Proposition IDs", metadata.IDs)
+	}
+	add("Exported", time.Now().Format(time.RFC3339))
+
+	return s
+}
+
+type xlsxContentTypes struct {
+	XMLName   xml.Name        `xml:"Types"`
+	XMLNS     string          `xml:"xmlns,attr"`
+	Defaults  []*xlsxDefault  `xml:"Default"`
+	Overrides []*xlsxOverride `xml:"Override"`
+}
+
+type xlsxDefault struct {
+	Extension   string `xml:"Extension,attr"`
+	ContentType string `xml:"ContentType,attr"`
+}
+
+type xlsxOverride struct {
+	PartName    string `xml:"PartName,attr"`
+	ContentType string `xml:"ContentType,attr"`
+}
+
+type xlsxRelationships struct {
+	XMLName       xml.Name            `xml:"Relationships"`
+	XMLNS         string              `xml:"xmlns,attr"`
+	Relationships []*xlsxRelationship `xml:"Relationship"`
+}
+
+type xlsxRelationship struct {
+	ID     string `xml:"Id,attr"`
+	Type   string `xml:"Type,attr"`
+	Target string `xml:"Target,attr"`
+}
+
+type xlsxWorkbook struct {
+	XMLName xml.Name         `xml:"workbook"`
+	XMLNS   string           `xml:"xmlns,attr"`
+	XMLNSR  string           `xml:"xmlns:r,attr"`
+	Sheets  []*xlsxSheetLink `xml:"sheets>sheet"`
+}
+
+type xlsxSheetLink struct {
+	Name    string `xml:"name,attr"`
+	SheetID int    `xml:"sheetId,attr"`
+	RelID   string `xml:"r:id,attr"`
+}
+
+type xlsxWorksheet struct {
+	XMLName xml.Name   `xml:"worksheet"`
+	XMLNS   string     `xml:"xmlns,attr"`
+	Rows    []*xlsxRow `xml:"sheetData>row"`
+}
+
+type xlsxRow struct {
+	Index int         `xml:"r,attr"`
+	Cells []*xlsxCell `xml:"c"`
+}
+
+type xlsxCell struct {
+	Ref    string      `xml:"r,attr"`
+	Type   string      `xml:"t,attr,omitempty"`
+	Value  string      `xml:"v,omitempty"`
+	Inline *xlsxInline `xml:"is,omitempty"`
+}
+
+type xlsxInline struct {
+	Text string `xml:"t"`
+}
+
+// xmlPart is a file in the workbook archive.
+type xmlPart struct {
+	name    string
+	content interface{}
+}
+
+func writeWorkbook(archive *zip.Writer, sheets []*sheet) error {
+	contentTypes := &xlsxContentTypes{
+		XMLNS: contentTypesNS,
+		Defaults: []*xlsxDefault{
+			{Extension: "rels", ContentType: relsType},
+			{Extension: "xml", ContentType: "application/xml"},
+		},
+		Overrides: []*xlsxOverride{
+			{PartName: "/xl/workbook.xml", ContentType: workbookType},
+		},
+	}
+	workbook := &xlsxWorkbook{
+		XMLNS:  spreadsheetNS,
+		XMLNSR: relationshipsNS,
+	}
+	workbookRels := &xlsxRelationships{XMLNS: packageRelNS}
+	for i, s := range sheets {
+		id := fmt.Sprintf("rId%d", i+1)
+		target := fmt.Sprintf("worksheets/sheet%d.xml", i+1)
+		contentTypes.Overrides = append(contentTypes.Overrides, &xlsxOverride{PartName: "/xl/" + target, ContentType: worksheetType})
+		workbook.Sheets = append(workbook.Sheets, &xlsxSheetLink{Name: s.name, SheetID: i + 1, RelID: id})
+		workbookRels.Relationships = append(workbookRels.Relationships, &xlsxRelationship{ID: id, Type: worksheetRel, Target: target})
+	}
+
+	parts := []*xmlPart{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", &xlsxRelationships{
+			XMLNS:         packageRelNS,
+			Relationships: []*xlsxRelationship{{ID: "rId1", Type: officeDocRel, Target: "xl/workbook.xml"}},
+		}},
+		{"xl/workbook.xml", workbook},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+	}
+	for i, s := range sheets {
+		parts = append(parts, &xmlPart{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), s.worksheet()})
+	}
+
+	for _, part := range parts {
+		err := writeXMLPart(archive, part.name, part.content)
+		if err != nil {
+			return errors.Wrapf(err, "unable to write '%s'", part.name)
+		}
+	}
+
+	return nil
+}
+
+func writeXMLPart(archive *zip.Writer, name string, content interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	return xml.NewEncoder(w).Encode(content)
+}
+
+// worksheet converts the sheet to its XML, writing strings inline so the
+// workbook needs no shared strings table.
+func (s *sheet) worksheet() *xlsxWorksheet {
+	worksheet := &xlsxWorksheet{XMLNS: spreadsheetNS}
+	for r, row := range s.rows {
+		xr := &xlsxRow{Index: r + 1}
+		for c, value := range row {
+			cell := &xlsxCell{Ref: cellRef(c, r)}
+			switch v := value.(type) {
+			case int:
+				cell.Value = strconv.Itoa(v)
+			case string:
+				if v == "" {
+					continue
+				}
+				cell.Type = "inlineStr"
+				cell.Inline = &xlsxInline{Text: v}
+			default:
+				cell.Type = "inlineStr"
+				cell.Inline = &xlsxInline{Text: fmt.Sprintf("%v", v)}
+			}
+			xr.Cells = append(xr.Cells, cell)
+		}
+		worksheet.Rows = append(worksheet.Rows, xr)
+	}
+
+	return worksheet
+}
+
+// cellRef returns the A1 style reference of the zero based column and row.
+func cellRef(column int, row int) string {
+	name := ""
+	for column++; column > 0; column = (column - 1) / 26 {
+		name = string(rune('A'+(column-1)%26)) + name
+	}
+
+	return fmt.Sprintf("%s%d", name, row+1)
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	log "github.com/unchartedsoftware/plog"
+
+	"github.com/phorne-uncharted/proposition-poc/api/auth"
+)
+
+// Auth returns a middleware that authenticates the requests to paths under
+// the prefixes, responding through onError when the credentials are missing or
+// invalid. The principal of an authenticated request is added to its context.
+// Requests to other paths, such as the static files, pass through untouched.
+func Auth(authenticator *auth.Authenticator, onError func(http.ResponseWriter, error), prefixes ...string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if !hasPrefix(r.URL.Path, prefixes) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			principal, err := authenticator.Authenticate(r)
+			if err != nil {
+				log.Warnf("audit: rejected %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="proposition-poc"`)
+				onError(w, err)
+				return
+			}
+
+			h.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func hasPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	uuid "github.com/gofrs/uuid"
+	log "github.com/unchartedsoftware/plog"
+)
+
+// RequestIDHeader is the header carrying the id of a request.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID is a middleware that gives each request an id, taken from the
+// request header when the client sets one, and returns it in the response
+// header so errors can be traced back to the request.
+func RequestID(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			generated, err := uuid.NewV4()
+			if err != nil {
+				log.Warnf("unable to generate request id: %v", err)
+			}
+			id = generated.String()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,256 @@
+package quota
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	hour = time.Hour
+	day  = 24 * time.Hour
+
+	// runningRetry is how long a client is asked to wait when too many crawls
+	// are running, since there is no telling when one will end.
+	runningRetry = 30 * time.Second
+
+	limitConcurrent = "concurrent crawls"
+	limitHourly     = "crawls per hour"
+	limitDaily      = "pages per day"
+)
+
+// Limits caps the crawls of the server or of a single client. A limit of 0
+// means unlimited.
+type Limits struct {
+	Concurrent   int `json:"concurrent"`
+	HourlyCrawls int `json:"hourlyCrawls"`
+	DailyPages   int `json:"dailyPages"`
+}
+
+// LimitError is returned when a crawl would exceed a limit, along with how
+// long to wait before trying again.
+type LimitError struct {
+	Scope      string
+	Limit      string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit of %s reached, retry after %v", e.Scope, e.Limit, e.RetryAfter.Round(time.Second))
+}
+
+// Usage is what the server or a client has used of its limits.
+type Usage struct {
+	Running      int `json:"running"`
+	HourlyCrawls int `json:"hourlyCrawls"`
+	DailyPages   int `json:"dailyPages"`
+}
+
+// Report lists the limits along with the usage of the server and of every
+// client that has crawled in the last day.
+type Report struct {
+	Server       Limits            `json:"serverLimits"`
+	Client       Limits            `json:"clientLimits"`
+	ServerUsage  *Usage            `json:"serverUsage"`
+	ClientUsages map[string]*Usage `json:"clientUsages"`
+}
+
+// pageCount is the pages a crawl has visited, counted as it visits them.
+type pageCount struct {
+	time  time.Time
+	count int
+}
+
+// usage records the running crawls, the start of each crawl in the last hour
+// and the pages of each crawl in the last day.
+type usage struct {
+	running int
+	starts  []time.Time
+	pages   []*pageCount
+}
+
+// Tracker admits crawls while the server and the client starting them are
+// within their limits.
+type Tracker struct {
+	server  Limits
+	client  Limits
+	total   *usage
+	clients map[string]*usage
+	lock    *sync.Mutex
+}
+
+// Lease is an admitted crawl, counting the pages it visits against the daily
+// page limits until it is released.
+type Lease struct {
+	// Pages is the most pages the crawl may visit, 0 being unlimited.
+	Pages    int
+	tracker  *Tracker
+	usages   []*usage
+	counts   []*pageCount
+	released bool
+}
+
+// NewTracker returns a tracker enforcing the server and per client limits.
+func NewTracker(server Limits, client Limits) *Tracker {
+	return &Tracker{
+		server:  server,
+		client:  client,
+		total:   &usage{},
+		clients: map[string]*usage{},
+		lock:    &sync.Mutex{},
+	}
+}
+
+// Acquire admits a crawl of up to the max pages for the client, 0 being
+// unlimited. The pages are capped at what is left of the daily page limits,
+// but nothing is reserved: pages only count against the limits as the crawl
+// visits them, so one long crawl cannot lock other clients out. Crawls running
+// side by side can therefore together visit more than what was left when they
+// started. A limit error is returned when the server or the client is at one
+// of its limits.
+func (t *Tracker) Acquire(client string, maxPages int) (*Lease, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+	clientUsage, ok := t.clients[client]
+	if !ok {
+		clientUsage = &usage{}
+		t.clients[client] = clientUsage
+	}
+	t.total.prune(now)
+	clientUsage.prune(now)
+
+	pages, err := t.total.admit("server", t.server, maxPages, now)
+	if err != nil {
+		return nil, err
+	}
+	pages, err = clientUsage.admit(fmt.Sprintf("client '%s'", client), t.client, pages, now)
+	if err != nil {
+		return nil, err
+	}
+
+	lease := &Lease{Pages: pages, tracker: t}
+	for _, u := range []*usage{t.total, clientUsage} {
+		count := &pageCount{time: now}
+		u.running++
+		u.starts = append(u.starts, now)
+		u.pages = append(u.pages, count)
+		lease.usages = append(lease.usages, u)
+		lease.counts = append(lease.counts, count)
+	}
+
+	return lease, nil
+}
+
+// Visit counts a page visited by the crawl against the daily page limits.
+func (l *Lease) Visit() {
+	l.tracker.lock.Lock()
+	defer l.tracker.lock.Unlock()
+	for _, count := range l.counts {
+		count.count++
+	}
+}
+
+// Release ends the crawl, keeping the pages it visited counted until they drop
+// out of the daily window.
+func (l *Lease) Release() {
+	l.tracker.lock.Lock()
+	defer l.tracker.lock.Unlock()
+	if l.released {
+		return
+	}
+	l.released = true
+	for _, u := range l.usages {
+		u.running--
+	}
+}
+
+// Report returns the limits and current usage.
+func (t *Tracker) Report() *Report {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+	t.total.prune(now)
+	report := &Report{
+		Server:       t.server,
+		Client:       t.client,
+		ServerUsage:  t.total.report(),
+		ClientUsages: map[string]*Usage{},
+	}
+	for client, u := range t.clients {
+		u.prune(now)
+		if u.running == 0 && len(u.pages) == 0 {
+			delete(t.clients, client)
+			continue
+		}
+		report.ClientUsages[client] = u.report()
+	}
+
+	return report
+}
+
+// admit checks the usage is within the limits, returning the max pages capped
+// at what is left of the daily page limit.
+func (u *usage) admit(scope string, limits Limits, maxPages int, now time.Time) (int, error) {
+	if limits.Concurrent > 0 && u.running >= limits.Concurrent {
+		return 0, &LimitError{Scope: scope, Limit: limitConcurrent, RetryAfter: runningRetry}
+	}
+	if limits.HourlyCrawls > 0 && len(u.starts) >= limits.HourlyCrawls {
+		// the oldest start drops out of the window first
+		return 0, &LimitError{Scope: scope, Limit: limitHourly, RetryAfter: u.starts[0].Add(hour).Sub(now)}
+	}
+	if limits.DailyPages > 0 {
+		left := limits.DailyPages - u.dailyPages()
+		if left <= 0 {
+			return 0, &LimitError{Scope: scope, Limit: limitDaily, RetryAfter: u.pagesFreed(-left + 1).Add(day).Sub(now)}
+		}
+		if maxPages == 0 || maxPages > left {
+			maxPages = left
+		}
+	}
+
+	return maxPages, nil
+}
+
+// prune drops the starts and pages that are out of their windows.
+func (u *usage) prune(now time.Time) {
+	for len(u.starts) > 0 && !u.starts[0].After(now.Add(-hour)) {
+		u.starts = u.starts[1:]
+	}
+	for len(u.pages) > 0 && !u.pages[0].time.After(now.Add(-day)) {
+		u.pages = u.pages[1:]
+	}
+}
+
+func (u *usage) dailyPages() int {
+	total := 0
+	for _, p := range u.pages {
+		total += p.count
+	}
+
+	return total
+}
+
+// pagesFreed returns when enough pages will have dropped out of the window to
+// free up the count.
+func (u *usage) pagesFreed(count int) time.Time {
+	freed := 0
+	for _, p := range u.pages {
+		freed += p.count
+		if freed >= count {
+			return p.time
+		}
+	}
+
+	return u.pages[len(u.pages)-1].time
+}
+
+func (u *usage) report() *Usage {
+	return &Usage{
+		Running:      u.running,
+		HourlyCrawls: len(u.starts),
+		DailyPages:   u.dailyPages(),
+	}
+}
@@ -0,0 +1,160 @@
+package quota
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUsageAdmit(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		usage    *usage
+		limits   Limits
+		maxPages int
+		want     int
+		limit    string
+	}{
+		{"unlimited", &usage{}, Limits{}, 0, 0, ""},
+		{"unlimited with max pages", &usage{}, Limits{}, 50, 50, ""},
+		{"below concurrent", &usage{running: 1}, Limits{Concurrent: 2}, 10, 10, ""},
+		{"at concurrent", &usage{running: 2}, Limits{Concurrent: 2}, 10, 0, limitConcurrent},
+		{"below hourly", &usage{starts: []time.Time{now}}, Limits{HourlyCrawls: 2}, 10, 10, ""},
+		{"at hourly", &usage{starts: []time.Time{now, now}}, Limits{HourlyCrawls: 2}, 10, 0, limitHourly},
+		{"max pages within daily", &usage{pages: []*pageCount{{now, 40}}}, Limits{DailyPages: 100}, 10, 10, ""},
+		{"max pages capped at daily", &usage{pages: []*pageCount{{now, 40}}}, Limits{DailyPages: 100}, 80, 60, ""},
+		{"unlimited pages capped at daily", &usage{pages: []*pageCount{{now, 40}}}, Limits{DailyPages: 100}, 0, 60, ""},
+		{"at daily", &usage{pages: []*pageCount{{now, 60}, {now, 40}}}, Limits{DailyPages: 100}, 10, 0, limitDaily},
+		{"over daily", &usage{pages: []*pageCount{{now, 120}}}, Limits{DailyPages: 100}, 10, 0, limitDaily},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pages, err := test.usage.admit("server", test.limits, test.maxPages, now)
+			if test.limit != "" {
+				limitErr, ok := err.(*LimitError)
+				if !ok {
+					t.Fatalf("expected a limit error, got %v", err)
+				}
+				if limitErr.Limit != test.limit {
+					t.Errorf("got limit '%s', want '%s'", limitErr.Limit, test.limit)
+				}
+				if limitErr.RetryAfter <= 0 {
+					t.Errorf("got retry after %v, want a positive wait", limitErr.RetryAfter)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if pages != test.want {
+				t.Errorf("got %d pages, want %d", pages, test.want)
+			}
+		})
+	}
+}
+
+func TestUsageAdmitRetryAfter(t *testing.T) {
+	now := time.Now()
+	u := &usage{
+		starts: []time.Time{now.Add(-50 * time.Minute), now.Add(-10 * time.Minute)},
+		pages:  []*pageCount{{now.Add(-20 * time.Hour), 30}, {now.Add(-2 * time.Hour), 70}},
+	}
+
+	_, err := u.admit("client", Limits{HourlyCrawls: 2}, 0, now)
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.RetryAfter != 10*time.Minute {
+		t.Errorf("expected a retry after the oldest start leaves the hour, got %v", err)
+	}
+
+	_, err = u.admit("client", Limits{DailyPages: 100}, 0, now)
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.RetryAfter != 4*time.Hour {
+		t.Errorf("expected a retry after the oldest pages leave the day, got %v", err)
+	}
+
+	_, err = u.admit("client", Limits{DailyPages: 60}, 0, now)
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.RetryAfter != 22*time.Hour {
+		t.Errorf("expected a retry after enough pages leave the day, got %v", err)
+	}
+}
+
+func TestUsagePrune(t *testing.T) {
+	now := time.Now()
+	u := &usage{
+		starts: []time.Time{now.Add(-2 * time.Hour), now.Add(-time.Minute)},
+		pages:  []*pageCount{{now.Add(-25 * time.Hour), 10}, {now.Add(-time.Hour), 20}},
+	}
+	u.prune(now)
+	if len(u.starts) != 1 || u.dailyPages() != 20 {
+		t.Errorf("got %d starts and %d pages, want 1 start and 20 pages", len(u.starts), u.dailyPages())
+	}
+}
+
+func TestLeaseCountsVisitedPages(t *testing.T) {
+	tracker := NewTracker(Limits{DailyPages: 10}, Limits{})
+
+	// an unlimited crawl does not hold the pages left for other clients
+	first, err := tracker.Acquire("first", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.Pages != 10 {
+		t.Errorf("got %d pages, want 10", first.Pages)
+	}
+	second, err := tracker.Acquire("second", 0)
+	if err != nil {
+		t.Fatalf("second client locked out: %v", err)
+	}
+
+	for i := 0; i < 6; i++ {
+		first.Visit()
+	}
+	first.Release()
+	first.Release()
+	third, err := tracker.Acquire("third", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if third.Pages != 4 {
+		t.Errorf("got %d pages, want the 4 left", third.Pages)
+	}
+
+	for i := 0; i < 4; i++ {
+		second.Visit()
+	}
+	_, err = tracker.Acquire("fourth", 0)
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.Limit != limitDaily {
+		t.Errorf("expected the daily page limit, got %v", err)
+	}
+
+	report := tracker.Report()
+	if report.ServerUsage.Running != 2 || report.ServerUsage.DailyPages != 10 {
+		t.Errorf("got server usage %+v, want 2 running and 10 pages", report.ServerUsage)
+	}
+	if report.ClientUsages["first"].Running != 0 || report.ClientUsages["first"].DailyPages != 6 {
+		t.Errorf("got first client usage %+v, want 0 running and 6 pages", report.ClientUsages["first"])
+	}
+}
+
+func TestTrackerClientLimits(t *testing.T) {
+	tracker := NewTracker(Limits{}, Limits{Concurrent: 1, DailyPages: 5})
+
+	lease, err := tracker.Acquire("client", 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lease.Pages != 5 {
+		t.Errorf("got %d pages, want 5", lease.Pages)
+	}
+	_, err = tracker.Acquire("client", 20)
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.Limit != limitConcurrent {
+		t.Errorf("expected the concurrent limit, got %v", err)
+	}
+	_, err = tracker.Acquire("other", 20)
+	if err != nil {
+		t.Errorf("other client limited by the first: %v", err)
+	}
+	lease.Release()
+	_, err = tracker.Acquire("client", 20)
+	if err != nil {
+		t.Errorf("unexpected error after release: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/phorne-uncharted/proposition-poc/api/auth"
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+	"github.com/phorne-uncharted/proposition-poc/api/sites"
+)
+
+// siteAccess is the part of the allowed sites the caller of a request may
+// crawl. Every allowed site is open when the routes are not authenticated.
+type siteAccess struct {
+	principal    *auth.Principal
+	client       string
+	allowedSites *sites.Registry
+}
+
+func newSiteAccess(r *http.Request, allowedSites *sites.Registry) *siteAccess {
+	return &siteAccess{
+		principal:    auth.FromContext(r.Context()),
+		client:       callerID(r),
+		allowedSites: allowedSites,
+	}
+}
+
+// match returns the allowed site entry for the hostname when the caller may
+// crawl it.
+func (a *siteAccess) match(host string) (*sites.Entry, bool) {
+	if !a.principal.Permits(host) {
+		return nil, false
+	}
+
+	return a.allowedSites.Match(host)
+}
+
+// allows returns true if the hostname is an allowed site the caller may crawl.
+func (a *siteAccess) allows(host string) bool {
+	_, ok := a.match(host)
+	return ok
+}
+
+// allowsURL returns true if the url is on an allowed site the caller may
+// crawl, so the caller may see the crawls of it.
+func (a *siteAccess) allowsURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	return a.allows(parsed.Hostname())
+}
+
+// canCancel returns true if the caller started the crawl job or is an admin.
+func (a *siteAccess) canCancel(job *crawl.Job) bool {
+	if a.principal != nil && a.principal.Admin {
+		return true
+	}
+
+	return job.Summary().Owner == a.client
+}
+
+// requireAdmin returns an error unless the caller of the request is an admin.
+// The admin routes are refused to every caller when the routes are not
+// authenticated.
+func requireAdmin(r *http.Request) error {
+	principal := auth.FromContext(r.Context())
+	if principal == nil || !principal.Admin {
+		return &forbiddenError{caller: callerID(r), route: r.URL.Path}
+	}
+
+	return nil
+}
+
+// callerID names the caller of the request in the audit log and quotas, by
+// its key or token subject, or by its address when the routes are not
+// authenticated.
+func callerID(r *http.Request) string {
+	principal := auth.FromContext(r.Context())
+	if principal != nil {
+		return principal.ID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,248 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/unchartedsoftware/plog"
+	"goji.io/v3/pat"
+
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+	"github.com/phorne-uncharted/proposition-poc/api/sites"
+)
+
+var (
+	crawlTimeout time.Duration
+)
+
+// SetCrawlTimeout sets how long a route waits for a crawl it runs itself
+// before giving up, no limit being set when it is 0. Background crawls are
+// limited by their max duration instead.
+func SetCrawlTimeout(timeout time.Duration) {
+	crawlTimeout = timeout
+}
+
+// CrawlStartHandler generates a route handler that starts a background crawl
+// and returns the job summary.
+func CrawlStartHandler(allowedSites *sites.Registry, jobs *crawl.JobManager) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := getPostParameters(r)
+		if err != nil {
+			handleError(w, errors.Wrap(err, "Unable to parse post parameters"))
+			return
+		}
+
+		access := newSiteAccess(r, allowedSites)
+		reader := newParamReader(params)
+		urlParsed := parseSiteURL(reader)
+		defaults := jobs.DefaultOptions()
+		if urlParsed != nil {
+			defaults = siteDefaults(access, urlParsed, defaults)
+		}
+		options := parseCrawlOptions(reader, defaults)
+		err = reader.err()
+		if err == nil {
+			options, err = siteOptions(access, urlParsed, options)
+		}
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		job, err := jobs.Start(urlParsed, options)
+		if err != nil {
+			handleError(w, errors.Wrap(err, "unable to start crawl"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		err = handleJSON(w, job.Summary())
+		if err != nil {
+			handleError(w, errors.Wrap(err, "unable to marshal crawl job into JSON"))
+			return
+		}
+	}
+}
+
+// CrawlStatusHandler generates a route handler that returns the state of a
+// crawl job.
+func CrawlStatusHandler(allowedSites *sites.Registry, jobs *crawl.JobManager) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := getJob(w, r, newSiteAccess(r, allowedSites), jobs)
+		if !ok {
+			return
+		}
+
+		err := handleJSON(w, job.Summary())
+		if err != nil {
+			handleError(w, errors.Wrap(err, "unable to marshal crawl job into JSON"))
+			return
+		}
+	}
+}
+
+// CrawlCancelHandler generates a route handler that cancels a crawl job. Only
+// the caller that started the job or an admin may cancel it.
+func CrawlCancelHandler(allowedSites *sites.Registry, jobs *crawl.JobManager) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		access := newSiteAccess(r, allowedSites)
+		job, ok := getJob(w, r, access, jobs)
+		if !ok {
+			return
+		}
+		if !access.canCancel(job) {
+			handleError(w, &forbiddenError{caller: access.client, route: r.URL.Path})
+			return
+		}
+
+		log.Infof("audit: '%s' cancelled crawl job %s", access.client, job.ID)
+		job.Cancel()
+
+		err := handleJSON(w, job.Summary())
+		if err != nil {
+			handleError(w, errors.Wrap(err, "unable to marshal crawl job into JSON"))
+			return
+		}
+	}
+}
+
+// CrawlEventsHandler generates a route handler that streams the progress of a
+// crawl job as server-sent events. A 'page' event is sent for every page
+// visited, followed by a 'summary' event once the job ends.
+func CrawlEventsHandler(allowedSites *sites.Registry, jobs *crawl.JobManager) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := getJob(w, r, newSiteAccess(r, allowedSites), jobs)
+		if !ok {
+			return
+		}
+
+		if _, ok := w.(http.Flusher); !ok {
+			handleError(w, errors.New("response does not support streaming"))
+			return
+		}
+
+		pages, events, unsubscribe := job.Subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		for _, page := range pages {
+			err := handleEvent(w, "page", page)
+			if err != nil {
+				log.Warnf("unable to send crawl event: %v", err)
+				return
+			}
+		}
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case page, ok := <-events:
+				if !ok {
+					err := handleEvent(w, "summary", job.Summary())
+					if err != nil {
+						log.Warnf("unable to send crawl event: %v", err)
+					}
+					return
+				}
+				err := handleEvent(w, "page", page)
+				if err != nil {
+					log.Warnf("unable to send crawl event: %v", err)
+					return
+				}
+			}
+		}
+	}
+}
+
+// getJob returns the crawl job named in the route, responding with not found
+// when there is no such job or it crawls a site the caller may not access.
+func getJob(w http.ResponseWriter, r *http.Request, access *siteAccess, jobs *crawl.JobManager) (*crawl.Job, bool) {
+	id := pat.Param(r, "id")
+	job, ok := jobs.Get(id)
+	if !ok || !access.allowsURL(job.URL) {
+		handleErrorType(w, errors.Errorf("crawl job '%s' not found", id), http.StatusNotFound)
+		return nil, false
+	}
+
+	return job, true
+}
+
+// treeCrawlDepth returns how deep to crawl for the tree views rendered to the
+// max depth. The treemap root is the site root so pages below the render depth
+// are not needed, while the treegraph adds a home node above the site root and
+// so needs a level less. Both crawl to the depth of the treemap so they share
+// a cached crawl of the site.
+func treeCrawlDepth(maxDepth int) int {
+	return maxDepth - 1
+}
+
+// loadGraph returns the crawled graph for a render request, arranged by the
+// requested hierarchy and coded with the requested code strategy. The url is
+// crawled no deeper than the render needs unless the request sets its own
+// crawl depth.
+func loadGraph(request *graphRequest, access *siteAccess, jobs *crawl.JobManager, crawlDepth int) (*crawl.Graph, error) {
+	if crawlDepth < 1 {
+		crawlDepth = 1
+	}
+	result, err := loadResult(request.siteRequest, access, jobs, crawlDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Graph(request.Hierarchy, request.Codes)
+}
+
+// loadResult returns the crawl result for a request. A finished crawl is used
+// when the request names one, then a recent crawl of the url with the same
+// options unless the request asks for a refresh, otherwise the url is crawled,
+// to the crawl depth when it is set and within the server depth limit. The
+// crawl times out after the crawl timeout, when one is set.
+func loadResult(request *siteRequest, access *siteAccess, jobs *crawl.JobManager, crawlDepth int) (*crawl.Result, error) {
+	if request.CrawlID != "" {
+		// the crawls of sites the caller may not access are not found, whether
+		// or not they completed
+		result, err := jobs.Result(request.CrawlID)
+		if job, ok := jobs.Get(request.CrawlID); ok && !access.allowsURL(job.URL) {
+			err = crawl.ErrNotFound
+		} else if err == nil && !access.allowsURL(result.Metadata.URL) {
+			err = crawl.ErrNotFound
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to load crawl '%s'", request.CrawlID)
+		}
+		return result, nil
+	}
+
+	options := request.Options
+	if crawlDepth > 0 && !request.DepthSet && (options.MaxDepth == 0 || crawlDepth < options.MaxDepth) {
+		options.MaxDepth = crawlDepth
+	}
+	options, err := siteOptions(access, request.URL, options)
+	if err != nil {
+		return nil, err
+	}
+	if !request.Refresh {
+		if result, ok := jobs.Cached(request.URL, options); ok {
+			log.Infof("using cached crawl %s of site '%s'", result.Metadata.ID, request.URL.String())
+			return result, nil
+		}
+	}
+
+	ctx := context.Background()
+	if crawlTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, crawlTimeout)
+		defer cancel()
+	}
+	result, err := jobs.Run(ctx, request.URL, options)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to crawl site")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+	log "github.com/unchartedsoftware/plog"
+
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+	"github.com/phorne-uncharted/proposition-poc/api/export"
+	"github.com/phorne-uncharted/proposition-poc/api/sites"
+)
+
+// DiffHandler generates a route handler that compares two crawls of a site.
+// The 'before' and 'after' parameters each name a stored crawl or a url to
+// crawl, taking the same parameters as the other crawl routes.
+func DiffHandler(allowedSites *sites.Registry, jobs *crawl.JobManager) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := getPostParameters(r)
+		if err != nil {
+			handleError(w, errors.Wrap(err, "Unable to parse post parameters"))
+			return
+		}
+
+		access := newSiteAccess(r, allowedSites)
+		reader := newParamReader(params)
+		format := reader.string("format", export.DiffFormatJSON)
+		contentType, err := export.DiffContentType(format)
+		reader.check("format", err)
+		hierarchy := reader.oneOf("hierarchy", "", crawl.Hierarchies, true)
+		codes := parseCodeOptions(reader)
+		beforeRequest := parseSiteRequest(reader.nested("before"), access, jobs.DefaultOptions())
+		afterRequest := parseSiteRequest(reader.nested("after"), access, jobs.DefaultOptions())
+		err = reader.err()
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		before, beforeGraph, err := loadCrawlGraph(beforeRequest, hierarchy, codes, access, jobs)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		after, afterGraph, err := loadCrawlGraph(afterRequest, hierarchy, codes, access, jobs)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		log.Infof("comparing crawls '%s' and '%s' of site '%s'", before.Metadata.ID, after.Metadata.ID, after.Metadata.URL)
+
+		diff := crawl.DiffGraphs(beforeGraph, afterGraph)
+		diff.Before = before.Metadata
+		diff.After = after.Metadata
+
+		w.Header().Set("Content-Type", contentType)
+		if format != export.DiffFormatJSON {
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", export.DiffFilename(format)))
+		}
+		err = export.WriteDiff(w, diff, format)
+		if err != nil {
+			log.Errorf("%+v", err)
+		}
+	}
+}
+
+// loadCrawlGraph returns the requested crawl, arranged by the hierarchy and
+// code strategies of the diff.
+func loadCrawlGraph(request *siteRequest, hierarchy string, codes crawl.CodeOptions, access *siteAccess, jobs *crawl.JobManager) (*crawl.Result, *crawl.Graph, error) {
+	result, err := loadResult(request, access, jobs, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	graph, err := result.Graph(hierarchy, codes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, graph, nil
+}
@@ -1,13 +1,76 @@
 package routes
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/pkg/errors"
 	log "github.com/unchartedsoftware/plog"
+
+	"github.com/phorne-uncharted/proposition-poc/api/auth"
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+	"github.com/phorne-uncharted/proposition-poc/api/middleware"
+	"github.com/phorne-uncharted/proposition-poc/api/quota"
+	"github.com/phorne-uncharted/proposition-poc/api/sites"
+)
+
+const (
+	// errorInvalidRequest is returned when the request parameters are invalid.
+	errorInvalidRequest = "invalid_request"
+	// errorUnauthorized is returned when the credentials are missing or
+	// invalid.
+	errorUnauthorized = "unauthorized"
+	// errorForbidden is returned when the caller may not use the route.
+	errorForbidden = "forbidden"
+	// errorHostNotAllowed is returned when the site is not an allowed site.
+	errorHostNotAllowed = "host_not_allowed"
+	// errorNotFound is returned when the requested crawl or allowed site does
+	// not exist.
+	errorNotFound = "not_found"
+	// errorCrawlNotCompleted is returned when the requested crawl is still
+	// running or was cancelled.
+	errorCrawlNotCompleted = "crawl_not_completed"
+	// errorUpstreamFailed is returned when the site could not be fetched.
+	errorUpstreamFailed = "upstream_failed"
+	// errorCrawlTimeout is returned when the crawl did not finish in time.
+	errorCrawlTimeout = "crawl_timeout"
+	// errorQuotaExceeded is returned when the crawl would exceed a server or
+	// client limit.
+	errorQuotaExceeded = "quota_exceeded"
+	// errorInternal is returned for any other error.
+	errorInternal = "internal_error"
 )
 
 var (
 	verboseError = false
+
+	errorCodes = map[int]string{
+		http.StatusBadRequest:          errorInvalidRequest,
+		http.StatusUnauthorized:        errorUnauthorized,
+		http.StatusForbidden:           errorHostNotAllowed,
+		http.StatusNotFound:            errorNotFound,
+		http.StatusConflict:            errorCrawlNotCompleted,
+		http.StatusBadGateway:          errorUpstreamFailed,
+		http.StatusGatewayTimeout:      errorCrawlTimeout,
+		http.StatusTooManyRequests:     errorQuotaExceeded,
+		http.StatusInternalServerError: errorInternal,
+	}
+
+	errorMessages = map[string]string{
+		errorInvalidRequest:    "The request is invalid",
+		errorUnauthorized:      "An API key or bearer token is required",
+		errorForbidden:         "The caller is not permitted to use this route",
+		errorHostNotAllowed:    "The site is not allowed",
+		errorNotFound:          "The requested resource was not found",
+		errorCrawlNotCompleted: "The crawl has not completed",
+		errorUpstreamFailed:    "The site could not be fetched",
+		errorCrawlTimeout:      "The crawl did not finish in time",
+		errorQuotaExceeded:     "Too many crawls have been started, try again later",
+		errorInternal:          "An error occured on the server while processing the request",
+	}
 )
 
 // SetVerboseError sets the flag determining if the client should receive
@@ -16,15 +79,129 @@ func SetVerboseError(verbose bool) {
 	verboseError = verbose
 }
 
+// errorResponse is the body of every error response. The details are only set
+// for invalid requests, listing each invalid parameter.
+type errorResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	RequestID string      `json:"requestId,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// hostError is returned when a request names a site that is not allowed.
+type hostError struct {
+	host string
+}
+
+func (e *hostError) Error() string {
+	return fmt.Sprintf("host '%s' is not allowed", e.host)
+}
+
+// forbiddenError is returned when a caller uses a route it is not permitted
+// to, such as an admin route when the routes are not authenticated.
+type forbiddenError struct {
+	caller string
+	route  string
+}
+
+func (e *forbiddenError) Error() string {
+	return fmt.Sprintf("'%s' is not permitted to use %s", e.caller, e.route)
+}
+
+// HandleError responds with the error, for the middleware rejecting requests
+// before they reach a route.
+func HandleError(w http.ResponseWriter, err error) {
+	handleError(w, err)
+}
+
+// handleError responds with the status matching the cause of the error.
 func handleError(w http.ResponseWriter, err error) {
-	handleErrorType(w, err, http.StatusInternalServerError)
+	status, code := errorStatus(err)
+	writeError(w, err, status, code)
 }
 
-func handleErrorType(w http.ResponseWriter, err error, code int) {
-	log.Errorf("%+v", err)
-	errMessage := "An error occured on the server while processing the request"
+func handleErrorType(w http.ResponseWriter, err error, status int) {
+	writeError(w, err, status, errorCodes[status])
+}
+
+func writeError(w http.ResponseWriter, err error, status int, code string) {
+	if status >= http.StatusInternalServerError {
+		log.Errorf("%+v", err)
+	} else {
+		log.Warnf("%v", err)
+	}
+
+	response := &errorResponse{
+		Code:      code,
+		RequestID: w.Header().Get(middleware.RequestIDHeader),
+	}
+	if response.Code == "" {
+		response.Code = errorInternal
+	}
+	response.Message = errorMessages[response.Code]
 	if verboseError {
-		errMessage = err.Error()
+		response.Message = err.Error()
+	}
+	if validation, ok := errors.Cause(err).(*ValidationError); ok {
+		// the client needs the invalid parameters to correct the request
+		response.Message = validation.Error()
+		response.Details = validation.Fields
+	}
+	if limit, ok := errors.Cause(err).(*quota.LimitError); ok {
+		// the client is told which limit was reached and when to try again
+		response.Message = limit.Error()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limit.RetryAfter.Seconds()))))
+	}
+
+	bytes, err := json.Marshal(response)
+	if err != nil {
+		log.Errorf("unable to marshal error response into JSON: %v", err)
+		http.Error(w, response.Message, status)
+		return
 	}
-	http.Error(w, errMessage, code)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, err = w.Write(bytes)
+	if err != nil {
+		log.Warnf("unable to write error response: %v", err)
+	}
+}
+
+// errorStatus returns the http status and error code for the cause of the
+// error.
+func errorStatus(err error) (int, string) {
+	// a site whose address or redirect is blocked is refused like a site that
+	// is not allowed
+	var blocked *crawl.BlockedError
+	if errors.As(err, &blocked) {
+		return http.StatusForbidden, errorHostNotAllowed
+	}
+
+	cause := errors.Cause(err)
+	switch cause.(type) {
+	case *ValidationError:
+		return http.StatusBadRequest, errorInvalidRequest
+	case *hostError:
+		return http.StatusForbidden, errorHostNotAllowed
+	case *forbiddenError:
+		return http.StatusForbidden, errorForbidden
+	case *crawl.FetchError:
+		return http.StatusBadGateway, errorUpstreamFailed
+	case *quota.LimitError:
+		return http.StatusTooManyRequests, errorQuotaExceeded
+	}
+
+	switch cause {
+	case auth.ErrUnauthorized:
+		return http.StatusUnauthorized, errorUnauthorized
+	case crawl.ErrNotFound, sites.ErrNotFound:
+		return http.StatusNotFound, errorNotFound
+	case crawl.ErrNotCompleted:
+		return http.StatusConflict, errorCrawlNotCompleted
+	case crawl.ErrTimeout:
+		return http.StatusGatewayTimeout, errorCrawlTimeout
+	}
+
+	return http.StatusInternalServerError, errorInternal
 }
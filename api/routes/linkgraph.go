@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+	log "github.com/unchartedsoftware/plog"
+
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+	"github.com/phorne-uncharted/proposition-poc/api/export"
+	"github.com/phorne-uncharted/proposition-poc/api/sites"
+)
+
+// LinkGraphHandler generates a route handler that returns every page and
+// every link between them as a graph file.
+func LinkGraphHandler(allowedSites *sites.Registry, jobs *crawl.JobManager) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := getPostParameters(r)
+		if err != nil {
+			handleError(w, errors.Wrap(err, "Unable to parse post parameters"))
+			return
+		}
+
+		access := newSiteAccess(r, allowedSites)
+		reader := newParamReader(params)
+		request := parseSiteRequest(reader, access, jobs.DefaultOptions())
+		format := reader.string("format", export.GraphFormatJGF)
+		contentType, err := export.GraphContentType(format)
+		reader.check("format", err)
+		err = reader.err()
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		result, err := loadResult(request, access, jobs, 0)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		log.Infof("exporting link graph of site '%s' as %s", result.Metadata.URL, format)
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", export.GraphFilename(format)))
+		err = export.WriteLinkGraph(w, result, format)
+		if err != nil {
+			log.Errorf("%+v", err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 
@@ -21,7 +22,12 @@ func getPostParameters(r *http.Request) (map[string]interface{}, error) {
 		return map[string]interface{}{}, nil
 	}
 
-	return util.Unmarshal(body)
+	params, err := util.Unmarshal(body)
+	if err != nil {
+		return nil, &ValidationError{Fields: []*FieldError{{Field: "body", Message: "must be a JSON object"}}}
+	}
+
+	return params, nil
 }
 
 func handleJSON(w http.ResponseWriter, data interface{}) error {
@@ -38,3 +44,20 @@ func handleJSON(w http.ResponseWriter, data interface{}) error {
 	}
 	return nil
 }
+
+func handleEvent(w http.ResponseWriter, event string, data interface{}) error {
+	// marshal data
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	// send server-sent event
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, bytes)
+	if err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
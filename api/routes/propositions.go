@@ -0,0 +1,107 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	log "github.com/unchartedsoftware/plog"
+
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+	"github.com/phorne-uncharted/proposition-poc/api/export"
+	"github.com/phorne-uncharted/proposition-poc/api/sites"
+)
+
+// PropositionsCSVHandler generates a route handler that streams the
+// propositions of a crawl as CSV.
+func PropositionsCSVHandler(allowedSites *sites.Registry, jobs *crawl.JobManager) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := getPostParameters(r)
+		if err != nil {
+			handleError(w, errors.Wrap(err, "Unable to parse post parameters"))
+			return
+		}
+
+		access := newSiteAccess(r, allowedSites)
+		reader := newParamReader(params)
+		request := parseGraphRequest(reader, access, jobs.DefaultOptions())
+		options := parseCSVOptions(reader)
+		err = reader.err()
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		result, err := loadResult(request.siteRequest, access, jobs, 0)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		graph, err := result.Graph(request.Hierarchy, request.Codes)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		log.Infof("exporting propositions of site '%s' as csv", graph.URL)
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"propositions.csv\"")
+		err = export.WritePropositionsCSV(w, graph, options)
+		if err != nil {
+			log.Errorf("%+v", err)
+		}
+	}
+}
+
+// PropositionsXLSXHandler generates a route handler that returns the
+// propositions of a crawl as an Excel workbook.
+func PropositionsXLSXHandler(allowedSites *sites.Registry, jobs *crawl.JobManager) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := getPostParameters(r)
+		if err != nil {
+			handleError(w, errors.Wrap(err, "Unable to parse post parameters"))
+			return
+		}
+
+		access := newSiteAccess(r, allowedSites)
+		reader := newParamReader(params)
+		request := parseGraphRequest(reader, access, jobs.DefaultOptions())
+		err = reader.err()
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		result, err := loadResult(request.siteRequest, access, jobs, 0)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		graph, err := result.Graph(request.Hierarchy, request.Codes)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		log.Infof("exporting propositions of site '%s' as xlsx", graph.URL)
+
+		w.Header().Set("Content-Type", export.XLSXContentType)
+		w.Header().Set("Content-Disposition", "attachment; filename=\"propositions.xlsx\"")
+		err = export.WriteXLSX(w, graph, result.Metadata)
+		if err != nil {
+			log.Errorf("%+v", err)
+		}
+	}
+}
+
+// parseCSVOptions reads the csv columns, delimiter and byte order mark,
+// checking the columns and delimiter are supported.
+func parseCSVOptions(r *paramReader) export.CSVOptions {
+	options := export.CSVOptions{
+		Columns:   r.stringArray("columns", nil),
+		Delimiter: r.string("delimiter", ""),
+		BOM:       r.bool("bom", false),
+	}
+	r.check("columns", export.ValidateColumns(options.Columns))
+	r.check("delimiter", export.ValidateDelimiter(options.Delimiter))
+
+	return options
+}
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/phorne-uncharted/proposition-poc/api/quota"
+)
+
+// QuotaHandler generates a route handler that returns the crawl limits along
+// with the current usage of the server and of each client.
+func QuotaHandler(quotas *quota.Tracker) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := requireAdmin(r)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		err = handleJSON(w, quotas.Report())
+		if err != nil {
+			handleError(w, errors.Wrap(err, "unable to marshal quota usage into JSON"))
+			return
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package routes
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+)
+
+var (
+	maxRenderDepth = 20
+)
+
+// SetMaxRenderDepth sets the deepest level a treemap or treegraph request can
+// render.
+func SetMaxRenderDepth(depth int) {
+	maxRenderDepth = depth
+}
+
+// FieldError is a request parameter that is missing or invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid parameter of a request.
+type ValidationError struct {
+	Fields []*FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = fmt.Sprintf("%s: %s", f.Field, f.Message)
+	}
+
+	return "invalid request parameters: " + strings.Join(messages, "; ")
+}
+
+// paramReader reads typed parameters from a request body, recording every
+// parameter that is missing or of the wrong type rather than stopping at the
+// first. Parameters set to null are treated as missing.
+type paramReader struct {
+	params map[string]interface{}
+	prefix string
+	fields *[]*FieldError
+}
+
+func newParamReader(params map[string]interface{}) *paramReader {
+	return &paramReader{
+		params: params,
+		fields: &[]*FieldError{},
+	}
+}
+
+// nested returns a reader for the object under the key, recording an error
+// when it is missing. Errors of the nested reader are reported against the
+// full field path, and dropped when the object itself is missing.
+func (r *paramReader) nested(key string) *paramReader {
+	nested := &paramReader{
+		params: map[string]interface{}{},
+		prefix: r.field(key) + ".",
+		fields: &[]*FieldError{},
+	}
+	value, ok := r.value(key)
+	if !ok {
+		r.fail(key, "is required")
+		return nested
+	}
+	params, ok := value.(map[string]interface{})
+	if !ok {
+		r.fail(key, "must be an object")
+		return nested
+	}
+	nested.params = params
+	nested.fields = r.fields
+
+	return nested
+}
+
+func (r *paramReader) field(key string) string {
+	return r.prefix + key
+}
+
+func (r *paramReader) value(key string) (interface{}, bool) {
+	value, ok := r.params[key]
+	if !ok || value == nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+func (r *paramReader) has(key string) bool {
+	_, ok := r.value(key)
+	return ok
+}
+
+// fail records the parameter as invalid.
+func (r *paramReader) fail(key string, format string, args ...interface{}) {
+	*r.fields = append(*r.fields, &FieldError{
+		Field:   r.field(key),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// check records the parameter as invalid when the error is set.
+func (r *paramReader) check(key string, err error) {
+	if err != nil {
+		r.fail(key, "%s", err.Error())
+	}
+}
+
+// err returns the validation error listing every invalid parameter, or nil
+// when all are valid.
+func (r *paramReader) err() error {
+	if len(*r.fields) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Fields: *r.fields}
+}
+
+func (r *paramReader) string(key string, def string) string {
+	value, ok := r.value(key)
+	if !ok {
+		return def
+	}
+	s, ok := value.(string)
+	if !ok {
+		r.fail(key, "must be a string")
+		return def
+	}
+
+	return s
+}
+
+func (r *paramReader) requiredString(key string) string {
+	if !r.has(key) {
+		r.fail(key, "is required")
+		return ""
+	}
+
+	return r.string(key, "")
+}
+
+func (r *paramReader) bool(key string, def bool) bool {
+	value, ok := r.value(key)
+	if !ok {
+		return def
+	}
+	b, ok := value.(bool)
+	if !ok {
+		r.fail(key, "must be a boolean")
+		return def
+	}
+
+	return b
+}
+
+// int reads a whole number no smaller than the min and, when the max is not
+// negative, no larger than the max.
+func (r *paramReader) int(key string, def int, min int, max int) int {
+	value, ok := r.value(key)
+	if !ok {
+		return def
+	}
+	f, ok := value.(float64)
+	if !ok || f != math.Trunc(f) {
+		r.fail(key, "must be a whole number")
+		return def
+	}
+	if f < float64(min) || (max >= 0 && f > float64(max)) {
+		if max >= 0 {
+			r.fail(key, "must be between %d and %d", min, max)
+		} else {
+			r.fail(key, "must be at least %d", min)
+		}
+		return def
+	}
+
+	return int(f)
+}
+
+func (r *paramReader) requiredInt(key string, min int, max int) int {
+	if !r.has(key) {
+		r.fail(key, "is required")
+		return min
+	}
+
+	return r.int(key, min, min, max)
+}
+
+// milliseconds reads a duration given as a whole number of milliseconds, no
+// shorter than the min and, when the max is not negative, no longer than the
+// max.
+func (r *paramReader) milliseconds(key string, def time.Duration, min time.Duration, max time.Duration) time.Duration {
+	if !r.has(key) {
+		return def
+	}
+	if max >= 0 {
+		max /= time.Millisecond
+	}
+
+	return time.Duration(r.int(key, int(def/time.Millisecond), int(min/time.Millisecond), int(max))) * time.Millisecond
+}
+
+// limit reads a crawl limit no larger than the server limit. A limit of 0 is
+// unlimited, so it is only accepted when the server sets no limit.
+func (r *paramReader) limit(key string, max int) int {
+	if max > 0 {
+		return r.int(key, max, 1, max)
+	}
+
+	return r.int(key, max, 0, -1)
+}
+
+// durationLimit reads a crawl duration limit in milliseconds no longer than the
+// server limit, 0 only being accepted when the server sets no limit.
+func (r *paramReader) durationLimit(key string, max time.Duration) time.Duration {
+	if max > 0 {
+		return r.milliseconds(key, max, time.Millisecond, max)
+	}
+
+	return r.milliseconds(key, max, 0, -1)
+}
+
+func (r *paramReader) stringArray(key string, def []string) []string {
+	value, ok := r.value(key)
+	if !ok {
+		return def
+	}
+	values, ok := value.([]interface{})
+	if !ok {
+		r.fail(key, "must be an array of strings")
+		return def
+	}
+	strs := make([]string, len(values))
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			r.fail(key, "must be an array of strings")
+			return def
+		}
+		strs[i] = s
+	}
+
+	return strs
+}
+
+// choices reads an array of strings that must each be one of the choices.
+func (r *paramReader) choices(key string, def []string, choices []string) []string {
+	if !r.has(key) {
+		return def
+	}
+
+	values := r.stringArray(key, def)
+	for _, value := range values {
+		if !containsChoice(choices, value) {
+			r.fail(key, "'%s' is not one of %s", value, strings.Join(choices, ", "))
+			return def
+		}
+	}
+
+	return values
+}
+
+// oneOf reads a string that must be one of the choices, or empty when
+// allowEmpty is set.
+func (r *paramReader) oneOf(key string, def string, choices []string, allowEmpty bool) string {
+	s := r.string(key, def)
+	if s == "" && allowEmpty {
+		return s
+	}
+	if containsChoice(choices, s) {
+		return s
+	}
+
+	named := []string{}
+	for _, c := range choices {
+		if c != "" {
+			named = append(named, c)
+		}
+	}
+	r.fail(key, "must be one of %s", strings.Join(named, ", "))
+
+	return def
+}
+
+// siteRequest names the crawl a request works on: a stored crawl, or a site to
+// crawl with the options given in the request.
+type siteRequest struct {
+	CrawlID string
+	URL     *url.URL
+	Options crawl.Options
+	// DepthSet is set when the request gives its own crawl depth.
+	DepthSet bool
+	// Refresh crawls the site again even when a recent crawl is cached.
+	Refresh bool
+}
+
+// graphRequest is a crawl along with how its pages are arranged and coded.
+type graphRequest struct {
+	*siteRequest
+	Hierarchy string
+	Codes     crawl.CodeOptions
+}
+
+// renderRequest is a graph rendered down to a depth.
+type renderRequest struct {
+	*graphRequest
+	MaxDepth int
+}
+
+// parseSiteRequest reads a stored crawl id or, failing that, the url of the
+// site to crawl. The crawl options start from the defaults of the site.
+func parseSiteRequest(r *paramReader, access *siteAccess, defaults crawl.Options) *siteRequest {
+	request := &siteRequest{
+		CrawlID: r.string("crawlId", ""),
+	}
+	if request.CrawlID == "" {
+		request.URL = parseSiteURL(r)
+	}
+	if request.URL != nil {
+		defaults = siteDefaults(access, request.URL, defaults)
+	}
+	request.Options = parseCrawlOptions(r, defaults)
+	request.DepthSet = r.has("maxCrawlDepth")
+	request.Refresh = r.bool("refresh", false)
+
+	return request
+}
+
+func parseGraphRequest(r *paramReader, access *siteAccess, defaults crawl.Options) *graphRequest {
+	return &graphRequest{
+		siteRequest: parseSiteRequest(r, access, defaults),
+		Hierarchy:   r.oneOf("hierarchy", "", crawl.Hierarchies, true),
+		Codes:       parseCodeOptions(r),
+	}
+}
+
+func parseRenderRequest(r *paramReader, access *siteAccess, defaults crawl.Options) *renderRequest {
+	return &renderRequest{
+		graphRequest: parseGraphRequest(r, access, defaults),
+		MaxDepth:     r.requiredInt("maxDepth", 1, maxRenderDepth),
+	}
+}
+
+// parseSiteURL reads the url of the site to crawl, which must be an http or
+// https url.
+func parseSiteURL(r *paramReader) *url.URL {
+	urlRaw := r.requiredString("url")
+	if urlRaw == "" {
+		return nil
+	}
+
+	urlParsed, err := url.Parse(urlRaw)
+	if err != nil {
+		r.fail("url", "is not a valid url")
+		return nil
+	}
+	if urlParsed.Scheme != "http" && urlParsed.Scheme != "https" {
+		r.fail("url", "must be an http or https url")
+		return nil
+	}
+	if urlParsed.Hostname() == "" {
+		r.fail("url", "must include a host")
+		return nil
+	}
+	return urlParsed
+}
+
+// parseCrawlOptions applies the crawl settings given in the request on top of
+// the server defaults. Delays and durations are given in milliseconds. The
+// server limits on depth, pages, duration and bytes are also the most a request
+// may ask for. A request may crawl more politely than the server settings but
+// never less: the delay is at least the server delay, the parallelism at most
+// the server parallelism, and robots.txt is only ignored when the server or
+// site policy says so.
+func parseCrawlOptions(r *paramReader, defaults crawl.Options) crawl.Options {
+	options := defaults
+	options.Parallelism = r.int("parallelism", options.Parallelism, 1, defaults.Parallelism)
+	options.Delay = r.milliseconds("delay", options.Delay, defaults.Delay, -1)
+	options.RandomDelay = r.milliseconds("randomDelay", options.RandomDelay, 0, -1)
+	if !r.bool("respectRobots", true) {
+		if defaults.RespectRobots {
+			r.fail("respectRobots", "can only be turned off by the server or site policy")
+		}
+	} else if r.has("respectRobots") {
+		options.RespectRobots = true
+	}
+	options.MaxDepth = r.limit("maxCrawlDepth", defaults.MaxDepth)
+	options.MaxPages = r.limit("maxPages", defaults.MaxPages)
+	options.MaxDuration = r.durationLimit("maxDuration", defaults.MaxDuration)
+	options.MaxBytes = int64(r.limit("maxBytes", int(defaults.MaxBytes)))
+	options.Sitemap = r.oneOf("sitemap", options.Sitemap, crawl.SitemapModes, true)
+	options.Labels = r.choices("labels", options.Labels, crawl.LabelSources)
+	options.LabelRule = r.oneOf("labelRule", options.LabelRule, crawl.LabelRules, true)
+	options.IDs = r.oneOf("ids", options.IDs, crawl.IDStrategies, true)
+
+	return options
+}
+
+func parseCodeOptions(r *paramReader) crawl.CodeOptions {
+	return crawl.CodeOptions{
+		Strategy:      r.oneOf("codeStrategy", crawl.CodeSlug, crawl.CodeStrategies, false),
+		Separator:     r.string("codeSeparator", ""),
+		SegmentLength: r.int("codeSegmentLength", 0, 0, -1),
+	}
+}
+
+// siteDefaults returns the default crawl options for the site, which are the
+// server defaults unless the site policy replaces them.
+func siteDefaults(access *siteAccess, site *url.URL, defaults crawl.Options) crawl.Options {
+	entry, ok := access.match(site.Hostname())
+	if !ok {
+		return defaults
+	}
+
+	return entry.Policy.Defaults(defaults)
+}
+
+// siteOptions returns the crawl options capped at the limits of the site
+// policy, only following redirects to allowed sites and owned by the caller
+// for the audit log and quotas, or an error when the site is not an allowed site the
+// caller may crawl.
+func siteOptions(access *siteAccess, site *url.URL, options crawl.Options) (crawl.Options, error) {
+	entry, ok := access.match(site.Hostname())
+	if !ok {
+		return options, &hostError{host: site.Hostname()}
+	}
+
+	options = entry.Policy.Limit(options)
+	options.AllowHost = access.allows
+	options.Owner = access.client
+
+	return options, nil
+}
+
+func containsChoice(choices []string, value string) bool {
+	for _, c := range choices {
+		if c == value {
+			return true
+		}
+	}
+
+	return false
+}
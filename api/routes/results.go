@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/unchartedsoftware/plog"
+	"goji.io/v3/pat"
+
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+	"github.com/phorne-uncharted/proposition-poc/api/sites"
+)
+
+// ResultListHandler generates a route handler that lists the stored crawls of
+// the sites the caller may access.
+func ResultListHandler(allowedSites *sites.Registry, store crawl.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		access := newSiteAccess(r, allowedSites)
+		metadata, err := store.List()
+		if err != nil {
+			handleError(w, errors.Wrap(err, "unable to list stored crawls"))
+			return
+		}
+
+		listed := []*crawl.Metadata{}
+		for _, m := range metadata {
+			if access.allowsURL(m.URL) {
+				listed = append(listed, m)
+			}
+		}
+
+		err = handleJSON(w, listed)
+		if err != nil {
+			handleError(w, errors.Wrap(err, "unable to marshal stored crawls into JSON"))
+			return
+		}
+	}
+}
+
+// ResultHandler generates a route handler that returns a stored crawl. The
+// crawls of sites the caller may not access are not found.
+func ResultHandler(allowedSites *sites.Registry, store crawl.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		access := newSiteAccess(r, allowedSites)
+		id := pat.Param(r, "id")
+		result, err := store.Load(id)
+		if err == nil && !access.allowsURL(result.Metadata.URL) {
+			err = crawl.ErrNotFound
+		}
+		if err == crawl.ErrNotFound {
+			handleErrorType(w, errors.Errorf("stored crawl '%s' not found", id), http.StatusNotFound)
+			return
+		} else if err != nil {
+			handleError(w, errors.Wrapf(err, "unable to load stored crawl '%s'", id))
+			return
+		}
+
+		err = handleJSON(w, result)
+		if err != nil {
+			handleError(w, errors.Wrap(err, "unable to marshal stored crawl into JSON"))
+			return
+		}
+	}
+}
+
+// ResultDeleteHandler generates a route handler that deletes a stored crawl.
+// Only admins may delete crawls.
+func ResultDeleteHandler(store crawl.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := requireAdmin(r)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		id := pat.Param(r, "id")
+		err = store.Delete(id)
+		if err == crawl.ErrNotFound {
+			handleErrorType(w, errors.Errorf("stored crawl '%s' not found", id), http.StatusNotFound)
+			return
+		} else if err != nil {
+			handleError(w, errors.Wrapf(err, "unable to delete stored crawl '%s'", id))
+			return
+		}
+
+		log.Infof("audit: '%s' deleted stored crawl %s", callerID(r), id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ResultPruneHandler generates a route handler that deletes every stored crawl
+// started before the time given in the 'before' query parameter. Only admins
+// may prune crawls.
+func ResultPruneHandler(store crawl.Store) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := requireAdmin(r)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		before, err := time.Parse(time.RFC3339, r.URL.Query().Get("before"))
+		if err != nil {
+			handleErrorType(w, errors.Wrap(err, "'before' must be an RFC3339 timestamp"), http.StatusBadRequest)
+			return
+		}
+
+		metadata, err := store.List()
+		if err != nil {
+			handleError(w, errors.Wrap(err, "unable to list stored crawls"))
+			return
+		}
+
+		deleted := []*crawl.Metadata{}
+		for _, m := range metadata {
+			if !m.StartTime.Before(before) {
+				continue
+			}
+			err = store.Delete(m.ID)
+			if err != nil {
+				handleError(w, errors.Wrapf(err, "unable to delete stored crawl '%s'", m.ID))
+				return
+			}
+			deleted = append(deleted, m)
+		}
+		log.Infof("audit: '%s' deleted %d stored crawls started before %v", callerID(r), len(deleted), before)
+
+		err = handleJSON(w, deleted)
+		if err != nil {
+			handleError(w, errors.Wrap(err, "unable to marshal deleted crawls into JSON"))
+			return
+		}
+	}
+}
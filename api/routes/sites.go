@@ -0,0 +1,117 @@
+package routes
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+	log "github.com/unchartedsoftware/plog"
+	"goji.io/v3/pat"
+
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+	"github.com/phorne-uncharted/proposition-poc/api/sites"
+)
+
+// SiteListHandler generates a route handler that lists the allowed sites.
+func SiteListHandler(allowedSites *sites.Registry) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := requireAdmin(r)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		err = handleJSON(w, allowedSites.Entries())
+		if err != nil {
+			handleError(w, errors.Wrap(err, "unable to marshal allowed sites into JSON"))
+			return
+		}
+	}
+}
+
+// SitePutHandler generates a route handler that adds an allowed site, or
+// replaces the policy of a site that is already allowed.
+func SitePutHandler(allowedSites *sites.Registry) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := requireAdmin(r)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		params, err := getPostParameters(r)
+		if err != nil {
+			handleError(w, errors.Wrap(err, "Unable to parse post parameters"))
+			return
+		}
+
+		reader := newParamReader(params)
+		site := reader.requiredString("site")
+		policy := &sites.Policy{}
+		if reader.has("policy") {
+			policy = parsePolicy(reader.nested("policy"))
+		}
+		entry, err := sites.NewEntry(site, policy)
+		if site != "" {
+			reader.check("site", err)
+		}
+		err = reader.err()
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		err = allowedSites.Put(entry)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		log.Infof("audit: '%s' allowed site '%s'", callerID(r), entry.Site)
+
+		err = handleJSON(w, entry)
+		if err != nil {
+			handleError(w, errors.Wrap(err, "unable to marshal allowed site into JSON"))
+			return
+		}
+	}
+}
+
+// SiteDeleteHandler generates a route handler that removes an allowed site.
+func SiteDeleteHandler(allowedSites *sites.Registry) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := requireAdmin(r)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		site, err := url.PathUnescape(pat.Param(r, "site"))
+		if err != nil {
+			handleErrorType(w, errors.Wrap(err, "unable to parse site"), http.StatusBadRequest)
+			return
+		}
+
+		err = allowedSites.Remove(site)
+		if err != nil {
+			handleError(w, errors.Wrapf(err, "unable to remove allowed site '%s'", site))
+			return
+		}
+		log.Infof("audit: '%s' removed allowed site '%s'", callerID(r), site)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// parsePolicy reads a site policy. The delay is given in milliseconds.
+func parsePolicy(r *paramReader) *sites.Policy {
+	return &sites.Policy{
+		MaxDepth:     r.int("maxDepth", 0, 0, -1),
+		MaxPages:     r.int("maxPages", 0, 0, -1),
+		Parallelism:  r.int("parallelism", 0, 0, -1),
+		Delay:        r.milliseconds("delay", 0, 0, -1),
+		Labels:       r.choices("labels", nil, crawl.LabelSources),
+		LabelRule:    r.oneOf("labelRule", "", crawl.LabelRules, true),
+		StartURLs:    r.stringArray("startUrls", nil),
+		IgnoreRobots: r.bool("ignoreRobots", false),
+	}
+}
@@ -0,0 +1,192 @@
+package sites
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+)
+
+const (
+	policyMaxDepth    = "maxDepth"
+	policyMaxPages    = "maxPages"
+	policyParallelism = "parallelism"
+	policyDelay       = "delay"
+	policyLabels      = "labels"
+	policyLabelRule   = "labelRule"
+	policyStart       = "start"
+	policyRobots      = "ignoreRobots"
+
+	listSeparator = ","
+)
+
+// Policy is how an allowed site may be crawled. The limits cap what a request
+// can ask for, while the labels and start urls replace the server defaults for
+// the site. Ignoring robots.txt is only ever set by the policy, never by a
+// request. A zero value leaves the request or server setting in place.
+type Policy struct {
+	MaxDepth     int           `json:"maxDepth,omitempty"`
+	MaxPages     int           `json:"maxPages,omitempty"`
+	Parallelism  int           `json:"parallelism,omitempty"`
+	Delay        time.Duration `json:"-"`
+	Labels       []string      `json:"labels,omitempty"`
+	LabelRule    string        `json:"labelRule,omitempty"`
+	StartURLs    []string      `json:"startUrls,omitempty"`
+	IgnoreRobots bool          `json:"ignoreRobots,omitempty"`
+}
+
+// MarshalJSON writes the delay in milliseconds, as the crawl routes take it.
+func (p *Policy) MarshalJSON() ([]byte, error) {
+	type policyJSON Policy
+	return json.Marshal(&struct {
+		*policyJSON
+		Delay int64 `json:"delay,omitempty"`
+	}{
+		policyJSON: (*policyJSON)(p),
+		Delay:      int64(p.Delay / time.Millisecond),
+	})
+}
+
+// Validate checks the limits are not negative and the label settings are
+// known.
+func (p *Policy) Validate() error {
+	if p.MaxDepth < 0 || p.MaxPages < 0 || p.Parallelism < 0 || p.Delay < 0 {
+		return errors.New("policy limits cannot be negative")
+	}
+
+	options := crawl.Options{Labels: p.Labels, LabelRule: p.LabelRule}
+	return options.Validate()
+}
+
+// Defaults returns the options with the site labels, start urls and robots.txt
+// setting in place of the server defaults. Settings in the request are applied
+// on top.
+func (p *Policy) Defaults(options crawl.Options) crawl.Options {
+	if p == nil {
+		return options
+	}
+	if len(p.Labels) > 0 {
+		options.Labels = p.Labels
+	}
+	if p.LabelRule != "" {
+		options.LabelRule = p.LabelRule
+	}
+	if len(p.StartURLs) > 0 {
+		options.StartURLs = p.StartURLs
+	}
+	if p.IgnoreRobots {
+		options.RespectRobots = false
+	}
+
+	return options
+}
+
+// Limit caps the depth, pages and parallelism of the options at the site
+// limits, and slows the crawl to at least the site delay.
+func (p *Policy) Limit(options crawl.Options) crawl.Options {
+	if p == nil {
+		return options
+	}
+	options.MaxDepth = limit(options.MaxDepth, p.MaxDepth)
+	options.MaxPages = limit(options.MaxPages, p.MaxPages)
+	options.Parallelism = limit(options.Parallelism, p.Parallelism)
+	if options.Delay < p.Delay {
+		options.Delay = p.Delay
+	}
+
+	return options
+}
+
+// limit caps the value at the max, a value of 0 being unlimited.
+func limit(value int, max int) int {
+	if max > 0 && (value == 0 || value > max) {
+		return max
+	}
+
+	return value
+}
+
+// parsePolicy reads the key=value settings following the site in an allowed
+// sites file.
+func parsePolicy(fields []string) (*Policy, error) {
+	policy := &Policy{}
+	for _, field := range fields {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, errors.Errorf("policy setting '%s' must be key=value", field)
+		}
+		key, value := parts[0], parts[1]
+
+		var err error
+		switch key {
+		case policyMaxDepth:
+			policy.MaxDepth, err = strconv.Atoi(value)
+		case policyMaxPages:
+			policy.MaxPages, err = strconv.Atoi(value)
+		case policyParallelism:
+			policy.Parallelism, err = strconv.Atoi(value)
+		case policyDelay:
+			policy.Delay, err = time.ParseDuration(value)
+		case policyLabels:
+			policy.Labels = strings.Split(value, listSeparator)
+		case policyLabelRule:
+			policy.LabelRule = value
+		case policyStart:
+			policy.StartURLs = strings.Split(value, listSeparator)
+		case policyRobots:
+			policy.IgnoreRobots, err = strconv.ParseBool(value)
+		default:
+			return nil, errors.Errorf("unknown policy setting '%s'", key)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse policy setting '%s'", key)
+		}
+	}
+
+	err := policy.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// fields returns the key=value settings of the policy as written to an allowed
+// sites file.
+func (p *Policy) fields() []string {
+	fields := []string{}
+	add := func(key string, value string) {
+		fields = append(fields, fmt.Sprintf("%s=%s", key, value))
+	}
+	if p.MaxDepth > 0 {
+		add(policyMaxDepth, strconv.Itoa(p.MaxDepth))
+	}
+	if p.MaxPages > 0 {
+		add(policyMaxPages, strconv.Itoa(p.MaxPages))
+	}
+	if p.Parallelism > 0 {
+		add(policyParallelism, strconv.Itoa(p.Parallelism))
+	}
+	if p.Delay > 0 {
+		add(policyDelay, p.Delay.String())
+	}
+	if len(p.Labels) > 0 {
+		add(policyLabels, strings.Join(p.Labels, listSeparator))
+	}
+	if p.LabelRule != "" {
+		add(policyLabelRule, p.LabelRule)
+	}
+	if len(p.StartURLs) > 0 {
+		add(policyStart, strings.Join(p.StartURLs, listSeparator))
+	}
+	if p.IgnoreRobots {
+		add(policyRobots, strconv.FormatBool(p.IgnoreRobots))
+	}
+
+	return fields
+}
@@ -0,0 +1,285 @@
+package sites
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/unchartedsoftware/plog"
+
+	"github.com/phorne-uncharted/proposition-poc/api/util"
+)
+
+const (
+	commentPrefix = "#"
+)
+
+var (
+	// ErrNotFound is returned when removing a site that is not in the registry.
+	ErrNotFound = errors.New("allowed site not found")
+
+	hostnamePattern = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+)
+
+// Entry is an allowed site along with the policy for crawling it. The site is
+// a hostname, or a wildcard such as '*.example.com' matching every subdomain
+// of the domain but not the domain itself.
+type Entry struct {
+	Site   string  `json:"site"`
+	Policy *Policy `json:"policy"`
+}
+
+// NewEntry returns an entry for the site after checking the site is a
+// hostname or wildcard and the policy is valid.
+func NewEntry(site string, policy *Policy) (*Entry, error) {
+	site = strings.ToLower(strings.TrimSpace(site))
+	if !hostnamePattern.MatchString(site) {
+		return nil, errors.Errorf("site '%s' must be a hostname or a wildcard such as '*.example.com'", site)
+	}
+	if policy == nil {
+		policy = &Policy{}
+	}
+	err := policy.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Entry{Site: site, Policy: policy}, nil
+}
+
+// line returns the entry as written to an allowed sites file.
+func (e *Entry) line() string {
+	return strings.Join(append([]string{e.Site}, e.Policy.fields()...), " ")
+}
+
+// Registry holds the allowed sites read from a file, one site per line
+// followed by its policy settings as key=value pairs. Blank lines and lines
+// starting with '#' are ignored. The registry can be reloaded while in use,
+// keeping the previous sites if the file is invalid.
+type Registry struct {
+	filename string
+	entries  []*Entry
+	modTime  time.Time
+	lock     *sync.RWMutex
+}
+
+// NewRegistry loads the allowed sites from the file. An empty filename allows
+// every site, for the command line commands run without an allowed sites
+// file.
+func NewRegistry(filename string) (*Registry, error) {
+	r := &Registry{
+		filename: filename,
+		entries:  []*Entry{},
+		lock:     &sync.RWMutex{},
+	}
+	if filename == "" {
+		return r, nil
+	}
+
+	err := r.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload reads the allowed sites file again.
+func (r *Registry) Reload() error {
+	log.Infof("loading allowed sites from file '%s'", r.filename)
+	info, err := os.Stat(r.filename)
+	if err != nil {
+		return errors.Wrap(err, "unable to open allowed sites file")
+	}
+	contents, err := ioutil.ReadFile(r.filename)
+	if err != nil {
+		return errors.Wrap(err, "unable to read allowed sites file")
+	}
+	entries, err := parseEntries(contents)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	// an invalid file is not read again until it changes
+	r.modTime = info.ModTime()
+	if err != nil {
+		return err
+	}
+	r.entries = entries
+	log.Infof("%d allowed sites loaded from file", len(entries))
+
+	return nil
+}
+
+// Watch reloads the allowed sites whenever the file changes, checking it at
+// the interval until the stop channel is closed.
+func (r *Registry) Watch(interval time.Duration, stop <-chan struct{}) {
+	util.WatchFile(r.filename, "allowed sites", interval, stop, r.loaded, r.Reload)
+}
+
+func (r *Registry) loaded() time.Time {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.modTime
+}
+
+// Match returns the entry allowing the hostname. An exact entry is used ahead
+// of a wildcard, and the longest wildcard ahead of shorter ones. Every site is
+// allowed, without a policy, when the registry has no file.
+func (r *Registry) Match(host string) (*Entry, bool) {
+	if r.filename == "" {
+		return &Entry{Site: host, Policy: &Policy{}}, true
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	sites := make([]string, len(r.entries))
+	for i, e := range r.entries {
+		sites[i] = e.Site
+	}
+	site, ok := util.MatchSite(sites, host)
+	if !ok {
+		return nil, false
+	}
+	for _, e := range r.entries {
+		if e.Site == site {
+			return e, true
+		}
+	}
+
+	return nil, false
+}
+
+// Allows returns true if the hostname is an allowed site.
+func (r *Registry) Allows(host string) bool {
+	_, ok := r.Match(host)
+	return ok
+}
+
+// Entries returns the allowed sites in file order.
+func (r *Registry) Entries() []*Entry {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return append([]*Entry{}, r.entries...)
+}
+
+// Put adds the entry to the file, replacing the entry for the same site if
+// there is one.
+func (r *Registry) Put(entry *Entry) error {
+	return r.update(func(lines []string) []string {
+		replaced := false
+		for i, line := range lines {
+			if lineSite(line) == entry.Site {
+				lines[i] = entry.line()
+				replaced = true
+			}
+		}
+		if !replaced {
+			lines = append(lines, entry.line())
+		}
+		return lines
+	})
+}
+
+// Remove removes the entry for the site from the file.
+func (r *Registry) Remove(site string) error {
+	site = strings.ToLower(site)
+	if _, ok := r.find(site); !ok {
+		return ErrNotFound
+	}
+
+	return r.update(func(lines []string) []string {
+		kept := []string{}
+		for _, line := range lines {
+			if lineSite(line) != site {
+				kept = append(kept, line)
+			}
+		}
+		return kept
+	})
+}
+
+func (r *Registry) find(site string) (*Entry, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, e := range r.entries {
+		if e.Site == site {
+			return e, true
+		}
+	}
+
+	return nil, false
+}
+
+// update rewrites the lines of the allowed sites file, keeping the comments
+// and blank lines, then reloads it.
+func (r *Registry) update(edit func(lines []string) []string) error {
+	if r.filename == "" {
+		return errors.New("no allowed sites file to update")
+	}
+
+	r.lock.Lock()
+	contents, err := ioutil.ReadFile(r.filename)
+	if err != nil {
+		r.lock.Unlock()
+		return errors.Wrap(err, "unable to read allowed sites file")
+	}
+	lines := strings.Split(strings.TrimRight(string(contents), "\n"), "\n")
+	if len(contents) == 0 {
+		lines = []string{}
+	}
+	updated := []byte(strings.Join(edit(lines), "\n") + "\n")
+	_, err = parseEntries(updated)
+	if err == nil {
+		err = ioutil.WriteFile(r.filename, updated, 0644)
+	}
+	r.lock.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "unable to update allowed sites file")
+	}
+
+	return r.Reload()
+}
+
+func parseEntries(contents []byte) ([]*Entry, error) {
+	entries := []*Entry{}
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for number := 1; scanner.Scan(); number++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], commentPrefix) {
+			continue
+		}
+
+		policy, err := parsePolicy(fields[1:])
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse allowed sites file line %d", number)
+		}
+		entry, err := NewEntry(fields[0], policy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse allowed sites file line %d", number)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "unable to read allowed sites file")
+	}
+
+	return entries, nil
+}
+
+// lineSite returns the site of a line of the allowed sites file, or an empty
+// string for comments and blank lines.
+func lineSite(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], commentPrefix) {
+		return ""
+	}
+
+	return strings.ToLower(fields[0])
+}
@@ -0,0 +1,41 @@
+package util
+
+import (
+	"strings"
+)
+
+const (
+	// AllSites is the site matching every hostname.
+	AllSites = "*"
+
+	wildcardPrefix = "*."
+)
+
+// MatchSite returns the site matching the hostname. A site is a hostname
+// matching only itself, a wildcard such as '*.example.com' matching every
+// subdomain of the domain but not the domain itself, or '*' matching every
+// hostname. An exact site is used ahead of a wildcard, the longest wildcard
+// ahead of shorter ones, and '*' only when nothing else matches. Sites and
+// hostnames are compared ignoring case.
+func MatchSite(sites []string, host string) (string, bool) {
+	host = strings.ToLower(host)
+	match := ""
+	matched := false
+	for _, site := range sites {
+		lower := strings.ToLower(site)
+		switch {
+		case lower == host:
+			return site, true
+		case strings.HasPrefix(lower, wildcardPrefix) && strings.HasSuffix(host, lower[1:]):
+			if !matched || match == AllSites || len(site) > len(match) {
+				match, matched = site, true
+			}
+		case lower == AllSites:
+			if !matched {
+				match, matched = site, true
+			}
+		}
+	}
+
+	return match, matched
+}
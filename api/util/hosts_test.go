@@ -0,0 +1,35 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestMatchSite(t *testing.T) {
+	tests := []struct {
+		name  string
+		sites []string
+		host  string
+		want  string
+	}{
+		{"no sites", nil, "example.com", ""},
+		{"exact", []string{"example.com"}, "example.com", "example.com"},
+		{"case insensitive", []string{"Example.com"}, "EXAMPLE.com", "Example.com"},
+		{"other host", []string{"example.com"}, "example.org", ""},
+		{"wildcard", []string{"*.example.com"}, "www.example.com", "*.example.com"},
+		{"wildcard bare domain", []string{"*.example.com"}, "example.com", ""},
+		{"wildcard suffix only", []string{"*.example.com"}, "badexample.com", ""},
+		{"every site", []string{"*"}, "example.com", "*"},
+		{"exact ahead of wildcard", []string{"*.example.com", "www.example.com"}, "www.example.com", "www.example.com"},
+		{"longest wildcard", []string{"*.example.com", "*.shop.example.com", "*"}, "a.shop.example.com", "*.shop.example.com"},
+		{"wildcard ahead of every site", []string{"*", "*.example.com"}, "www.example.com", "*.example.com"},
+		{"every site when nothing else matches", []string{"*.example.com", "*"}, "example.org", "*"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := MatchSite(test.sites, test.host)
+			if ok != (test.want != "") || got != test.want {
+				t.Errorf("MatchSite(%v, %q) = %q, %v, want %q", test.sites, test.host, got, ok, test.want)
+			}
+		})
+	}
+}
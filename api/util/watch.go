@@ -0,0 +1,38 @@
+package util
+
+import (
+	"os"
+	"time"
+
+	log "github.com/unchartedsoftware/plog"
+)
+
+// WatchFile calls reload whenever the modification time of the file differs
+// from the one loaded, checking it at the interval until the stop channel is
+// closed. The description names the file and its contents in the log.
+func WatchFile(filename string, description string, interval time.Duration, stop <-chan struct{}, loaded func() time.Time, reload func() error) {
+	if filename == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(filename)
+			if err != nil {
+				log.Warnf("unable to check %s file: %v", description, err)
+				continue
+			}
+			if info.ModTime().Equal(loaded()) {
+				continue
+			}
+			err = reload()
+			if err != nil {
+				log.Errorf("keeping previous %s: %+v", description, err)
+			}
+		}
+	}
+}
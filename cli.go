@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
+	"github.com/phorne-uncharted/proposition-poc/api/export"
+	"github.com/phorne-uncharted/proposition-poc/api/sites"
+)
+
+const (
+	commandServe  = "serve"
+	commandCrawl  = "crawl"
+	commandExport = "export"
+	commandDiff   = "diff"
+
+	exportFormatCSV       = "csv"
+	exportFormatJSON      = "json"
+	exportFormatTreemap   = "treemap"
+	exportFormatTreeGraph = "treegraph"
+	exportFormatXLSX      = "xlsx"
+)
+
+// commandFlags are the flags shared by the commands that crawl or read
+// stored crawls.
+type commandFlags struct {
+	depth        int
+	allowedSites string
+	output       string
+	hierarchy    string
+	codeStrategy string
+}
+
+func newCommandFlags(name string) (*flag.FlagSet, *commandFlags) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	common := &commandFlags{}
+	flags.IntVar(&common.depth, "depth", 0, "max crawl depth, the configured depth when 0")
+	flags.StringVar(&common.allowedSites, "allowed-sites", "", "file listing the sites that may be crawled, any site when empty")
+	flags.StringVar(&common.output, "o", "", "output file, stdout when empty")
+	flags.StringVar(&common.hierarchy, "hierarchy", "", "hierarchy strategy used to find each page parent")
+	flags.StringVar(&common.codeStrategy, "code", crawl.CodeSlug, "code strategy")
+
+	return flags, common
+}
+
+// runCrawl crawls a site and stores the result, writing the crawl metadata so
+// the stored crawl can be exported later.
+func runCrawl(jobs *crawl.JobManager, args []string) error {
+	flags, common := newCommandFlags(commandCrawl)
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("crawl needs the url of the site to crawl")
+	}
+
+	result, err := crawlSite(jobs, flags.Arg(0), common)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(common.output, func(w io.Writer) error {
+		return writeJSON(w, result.Metadata)
+	})
+}
+
+// runExport writes the propositions of a crawl from the command line. The
+// crawl is either the id of a stored crawl or the url of a site to crawl.
+func runExport(jobs *crawl.JobManager, args []string) error {
+	flags, common := newCommandFlags(commandExport)
+	format := flags.String("format", exportFormatCSV, "output format, csv, json, treemap, treegraph or xlsx")
+	levels := flags.Int("levels", 0, "levels of the treemap and treegraph to write, every level when 0")
+	columns := flags.String("columns", "", "comma separated csv columns, the default columns when empty")
+	delimiter := flags.String("delimiter", "", "csv delimiter, a comma when empty")
+	bom := flags.Bool("bom", false, "start the csv with a byte order mark")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("export needs the crawl id or site url to export")
+	}
+
+	maxDepth := *levels
+	if maxDepth <= 0 {
+		maxDepth = math.MaxInt32
+	}
+	var write func(w io.Writer, result *crawl.Result, graph *crawl.Graph) error
+	switch *format {
+	case exportFormatCSV:
+		options := export.CSVOptions{
+			Delimiter: *delimiter,
+			BOM:       *bom,
+		}
+		if *columns != "" {
+			options.Columns = strings.Split(*columns, ",")
+		}
+		err = options.Validate()
+		if err != nil {
+			return err
+		}
+		write = func(w io.Writer, result *crawl.Result, graph *crawl.Graph) error {
+			return export.WritePropositionsCSV(w, graph, options)
+		}
+	case exportFormatJSON:
+		write = func(w io.Writer, result *crawl.Result, graph *crawl.Graph) error {
+			return writeJSON(w, graph)
+		}
+	case exportFormatTreemap:
+		write = func(w io.Writer, result *crawl.Result, graph *crawl.Graph) error {
+			return writeJSON(w, export.BuildTreemap(graph, maxDepth))
+		}
+	case exportFormatTreeGraph:
+		write = func(w io.Writer, result *crawl.Result, graph *crawl.Graph) error {
+			return writeJSON(w, export.BuildTreeGraph(graph, maxDepth))
+		}
+	case exportFormatXLSX:
+		write = func(w io.Writer, result *crawl.Result, graph *crawl.Graph) error {
+			return export.WriteXLSX(w, graph, result.Metadata)
+		}
+	default:
+		return errors.Errorf("unknown export format '%s'", *format)
+	}
+
+	result, graph, err := loadCLIGraph(jobs, flags.Arg(0), common)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(common.output, func(w io.Writer) error {
+		return write(w, result, graph)
+	})
+}
+
+// runDiff compares two crawls of a site from the command line. Each crawl is
+// either the id of a stored crawl or the url of a site to crawl.
+func runDiff(jobs *crawl.JobManager, args []string) error {
+	flags, common := newCommandFlags(commandDiff)
+	format := flags.String("format", export.DiffFormatJSON, "output format, json or csv")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("diff needs the crawl ids or site urls to compare")
+	}
+	if _, err := export.DiffContentType(*format); err != nil {
+		return err
+	}
+
+	before, beforeGraph, err := loadCLIGraph(jobs, flags.Arg(0), common)
+	if err != nil {
+		return err
+	}
+	after, afterGraph, err := loadCLIGraph(jobs, flags.Arg(1), common)
+	if err != nil {
+		return err
+	}
+
+	diff := crawl.DiffGraphs(beforeGraph, afterGraph)
+	diff.Before = before.Metadata
+	diff.After = after.Metadata
+
+	return writeOutput(common.output, func(w io.Writer) error {
+		return export.WriteDiff(w, diff, *format)
+	})
+}
+
+// loadCLIGraph loads the stored crawl with the id, or crawls the site when
+// given a url.
+func loadCLIGraph(jobs *crawl.JobManager, source string, common *commandFlags) (*crawl.Result, *crawl.Graph, error) {
+	var result *crawl.Result
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		result, err = crawlSite(jobs, source, common)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		result, err = jobs.Result(source)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "unable to load crawl '%s'", source)
+		}
+	}
+
+	graph, err := result.Graph(common.hierarchy, crawl.CodeOptions{Strategy: common.codeStrategy})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, graph, nil
+}
+
+// crawlSite crawls the site with the configured options and the depth set on
+// the command line, within the policy of the site when there is an allowed
+// sites file, storing the result.
+func crawlSite(jobs *crawl.JobManager, site string, common *commandFlags) (*crawl.Result, error) {
+	root, err := url.Parse(site)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse url")
+	}
+
+	allowedSites, err := sites.NewRegistry(common.allowedSites)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := allowedSites.Match(root.Hostname())
+	if !ok {
+		return nil, errors.Errorf("host '%s' not allowed", root.Hostname())
+	}
+
+	options := entry.Policy.Defaults(jobs.DefaultOptions())
+	if common.depth > 0 {
+		options.MaxDepth = common.depth
+	}
+	options = entry.Policy.Limit(options)
+	options.AllowHost = allowedSites.Allows
+
+	result, err := jobs.Run(context.Background(), root, options)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to crawl site")
+	}
+
+	return result, nil
+}
+
+// writeOutput writes to the output file, or to stdout when there is none.
+func writeOutput(output string, write func(w io.Writer) error) error {
+	if output == "" {
+		return write(os.Stdout)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return errors.Wrap(err, "unable to create output file")
+	}
+	defer file.Close()
+
+	err = write(file)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(file.Close(), "unable to write output file")
+}
+
+func writeJSON(w io.Writer, data interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
@@ -3,15 +3,18 @@ module github.com/phorne-uncharted/proposition-poc
 go 1.14
 
 require (
+	github.com/PuerkitoBio/goquery v1.5.1
 	github.com/caarlos0/env v3.5.0+incompatible
 	github.com/davecgh/go-spew v1.1.1
 	github.com/gocolly/colly v1.2.0
 	github.com/gocolly/colly/v2 v2.1.0
 	github.com/gofrs/uuid v4.2.0+incompatible
+	github.com/golang-jwt/jwt/v5 v5.2.3
 	github.com/golang/protobuf v1.4.2
 	github.com/mattn/go-isatty v0.0.12
 	github.com/mgutz/ansi v0.0.0-20200706080929-d51e80ef957d
 	github.com/pkg/errors v0.9.1
+	github.com/temoto/robotstxt v1.1.1
 	github.com/uncharted-distil/distil v0.0.0-20211212194252-0d40728414ff
 	github.com/unchartedsoftware/plog v0.0.0-20200807135627-83d59e50ced5
 	github.com/vova616/xxhash v0.0.0-20130313230233-f0a9a8b74d48
@@ -1,53 +1,28 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/csv"
-	"fmt"
-	"io/ioutil"
+	"flag"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
 	"syscall"
 
 	"github.com/davecgh/go-spew/spew"
-	"github.com/gocolly/colly/v2"
-	uuid "github.com/gofrs/uuid"
 	"github.com/pkg/errors"
 	log "github.com/unchartedsoftware/plog"
 	"github.com/zenazn/goji/graceful"
 	goji "goji.io/v3"
 	"goji.io/v3/pat"
 
+	"github.com/phorne-uncharted/proposition-poc/api/auth"
+	"github.com/phorne-uncharted/proposition-poc/api/crawl"
 	"github.com/phorne-uncharted/proposition-poc/api/env"
 	"github.com/phorne-uncharted/proposition-poc/api/middleware"
+	"github.com/phorne-uncharted/proposition-poc/api/quota"
 	"github.com/phorne-uncharted/proposition-poc/api/routes"
+	"github.com/phorne-uncharted/proposition-poc/api/sites"
 )
 
-// Proposition is an entity being extracted from a site.
-type Proposition struct {
-	ID            string
-	FullName      string
-	Tag           string
-	Code          string
-	URL           string
-	Key           string
-	PotentialTags []string
-	ParentURL     string
-}
-
-// ToPropertySlice converts a proposition to a string slice.
-func (p *Proposition) ToPropertySlice() []string {
-	return []string{
-		p.ID,
-		p.FullName,
-		p.Tag,
-		p.Code,
-		p.URL,
-	}
-}
-
 func registerRoute(mux *goji.Mux, pattern string, handler func(http.ResponseWriter, *http.Request)) {
 	log.Infof("Registering GET route %s", pattern)
 	mux.HandleFunc(pat.Get(pattern), handler)
@@ -58,7 +33,24 @@ func registerRoutePost(mux *goji.Mux, pattern string, handler func(http.Response
 	mux.HandleFunc(pat.Post(pattern), handler)
 }
 
+func registerRouteDelete(mux *goji.Mux, pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	log.Infof("Registering DELETE route %s", pattern)
+	mux.HandleFunc(pat.Delete(pattern), handler)
+}
+
 func main() {
+	command := commandServe
+	args := []string{}
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+		args = os.Args[2:]
+	}
+	// the other commands write their output to stdout so only warnings are
+	// logged
+	if command != commandServe {
+		log.SetLevel(log.WarnLevel)
+	}
+
 	// load config from env
 	config, err := env.LoadConfig()
 	if err != nil {
@@ -67,182 +59,190 @@ func main() {
 	}
 	log.Infof("%+v", spew.Sdump(config))
 
-	allowedSites, err := loadAllowedSites(config.AllowedSitesFile)
+	store, jobs, err := newJobManager(config)
 	if err != nil {
 		log.Errorf("%+v", err)
 		os.Exit(1)
 	}
 
-	// register routes
-	mux := goji.NewMux()
-	mux.Use(middleware.Log)
-	mux.Use(middleware.Gzip)
-	registerRoutePost(mux, "/site/treemap", routes.LinksHandler(allowedSites))
-	registerRoutePost(mux, "/site/treegraph", routes.TreeGraphHandler(allowedSites))
-
-	registerRoute(mux, "/*", routes.FileHandler("./dist"))
-
-	// catch kill signals for graceful shutdown
-	graceful.AddSignal(syscall.SIGINT, syscall.SIGTERM)
-
-	// kick off the server listen loop
-	log.Infof("Listening on port %s", config.AppPort)
-	err = graceful.ListenAndServe(":"+config.AppPort, mux)
+	switch command {
+	case commandServe:
+		err = runServe(config, store, jobs, args)
+	case commandCrawl:
+		err = runCrawl(jobs, args)
+	case commandExport:
+		err = runExport(jobs, args)
+	case commandDiff:
+		err = runDiff(jobs, args)
+	default:
+		err = errors.Errorf("unknown command '%s', expected one of %s, %s, %s or %s", command, commandServe, commandCrawl, commandExport, commandDiff)
+	}
+	if err == flag.ErrHelp {
+		return
+	}
 	if err != nil {
 		log.Errorf("%+v", err)
 		os.Exit(1)
 	}
-
-	// wait until server gracefully exits
-	graceful.Wait()
 }
 
-func loadAllowedSites(filename string) ([]string, error) {
-	log.Infof("loading allowed sites from file '%s'", filename)
-	file, err := os.Open(filename)
+func newJobManager(config env.Config) (crawl.Store, *crawl.JobManager, error) {
+	store, err := crawl.NewFileStore(config.CrawlStoreDir)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to open allowed sites file")
+		return nil, nil, err
 	}
-	defer file.Close()
-
-	allowedSites := []string{}
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		allowedSites = append(allowedSites, scanner.Text())
+	siteRules, err := crawl.LoadSiteRules(config.SiteRulesFile)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, errors.Wrap(err, "unable to read allowed sites file")
+	allowNetworks, err := crawl.ParseNetworks(config.CrawlAllowNetworks)
+	if err != nil {
+		return nil, nil, err
 	}
-	log.Infof("allowed sites loaded from file: %v", allowedSites)
-
-	return allowedSites, nil
-}
-
-func generate() {
-	nodes := map[string]*node{}
-	c := colly.NewCollector(
-		colly.AllowedDomains("onedemo-telco.azurewebsites.net"),
-	)
-
-	// Find and visit all links
-	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
-		e.Request.Ctx.Put("parent", e.Request.URL.String())
-		e.Request.Visit(e.Attr("href"))
-	})
-
-	//c.OnRequest(func(r *colly.Request) {
-	//	r.Ctx.Put("parent", r.URL)
-	//})
-
-	c.OnResponse(func(r *colly.Response) {
-		prop, _ := processLink(r)
-		nodes = addNode(nodes, prop)
-	})
-
-	c.Visit("https://onedemo-telco.azurewebsites.net/")
-
-	propositions := processGraph(nodes)
-	outputData("output.csv", propositions)
-}
-
-func processGraph(nodes map[string]*node) []*Proposition {
-	root := nodes[""]
-	return buildBreadCrumb(nil, root, []*Proposition{})
+	var pages *crawl.PageCache
+	if config.PageCacheDir != "" {
+		pages, err = crawl.NewPageCache(config.PageCacheDir, config.PageCacheMaxAge, config.PageCacheMaxSize)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	jobs := crawl.NewJobManager(store, crawl.Options{
+		UserAgent:     config.CrawlUserAgent,
+		Parallelism:   config.CrawlParallelism,
+		Delay:         config.CrawlDelay,
+		RandomDelay:   config.CrawlRandomDelay,
+		RespectRobots: config.CrawlRespectRobots,
+		MaxDepth:      config.CrawlMaxDepth,
+		MaxPages:      config.CrawlMaxPages,
+		MaxDuration:   config.CrawlMaxDuration,
+		MaxBytes:      config.CrawlMaxBytes,
+		Sitemap:       config.CrawlSitemap,
+		Labels:        config.CrawlLabels,
+		LabelRule:     config.CrawlLabelRule,
+		IDs:           config.PropositionIDs,
+		AllowNetworks: allowNetworks,
+		Pages:         pages,
+	}, siteRules)
+	jobs.SetJobTTL(config.CrawlJobTTL)
+
+	return store, jobs, nil
 }
 
-func buildBreadCrumb(parent *node, current *node, alreadyProcessed []*Proposition) []*Proposition {
-	if parent == nil {
-		current.data.FullName = fmt.Sprintf("/")
-	} else {
-		current.data.FullName = fmt.Sprintf("%s%s/", parent.data.FullName, current.data.Tag)
-		alreadyProcessed = append(alreadyProcessed, current.data)
+// runServe runs the web server until it is killed.
+func runServe(config env.Config, store crawl.Store, jobs *crawl.JobManager, args []string) error {
+	flags := flag.NewFlagSet(commandServe, flag.ContinueOnError)
+	port := flags.String("port", config.AppPort, "port to listen on")
+	allowedSitesFile := flags.String("allowed-sites", config.AllowedSitesFile, "file listing the sites that may be crawled")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
 	}
 
-	for _, c := range current.children {
-		alreadyProcessed = buildBreadCrumb(current, c, alreadyProcessed)
+	if *allowedSitesFile == "" {
+		return errors.New("serve needs an allowed sites file")
 	}
-
-	return alreadyProcessed
-}
-
-func addNode(nodes map[string]*node, proposition *Proposition) map[string]*node {
-	newNode := &node{
-		key:      proposition.URL,
-		children: []*node{},
-		data:     proposition,
-	}
-	nodes[newNode.key] = newNode
-	parentNode := nodes[newNode.data.ParentURL]
-	if parentNode == nil {
-		parentNode = &node{
-			key:      "",
-			children: []*node{},
-			data:     &Proposition{},
-		}
-		nodes[parentNode.key] = parentNode
+	allowedSites, err := sites.NewRegistry(*allowedSitesFile)
+	if err != nil {
+		return err
 	}
-	parentNode.children = append(parentNode.children, newNode)
-
-	return nodes
-}
-
-func outputData(outputName string, propositions []*Proposition) error {
-	mapped := [][]string{{"Proposition ID", "Proposition Full Name", "Proposition", "Proposition Code", "URL"}}
-	for _, p := range propositions {
-		mapped = append(mapped, p.ToPropertySlice())
+	stop := make(chan struct{})
+	defer close(stop)
+	if config.AllowedSitesReload > 0 {
+		go allowedSites.Watch(config.AllowedSitesReload, stop)
+		go jobs.SiteRules().Watch(config.AllowedSitesReload, stop)
 	}
-	var outputBuffer bytes.Buffer
-	csvWriter := csv.NewWriter(&outputBuffer)
-	err := csvWriter.WriteAll(mapped)
+	go reloadOnHangup(allowedSites, jobs.SiteRules())
+
+	authenticator, err := auth.NewAuthenticator(auth.Config{
+		KeysFile: config.AuthKeysFile,
+		Secret:   config.AuthJWTSecret,
+		JWKSFile: config.AuthJWKSFile,
+		Issuer:   config.AuthJWTIssuer,
+		Audience: config.AuthJWTAudience,
+	})
 	if err != nil {
-		return errors.Wrap(err, "unable to write csv data to buffer")
+		return err
+	}
+	if authenticator == nil {
+		log.Warnf("no api keys or token keys configured, the site routes are open and the admin routes are refused")
 	}
-	csvWriter.Flush()
 
-	err = ioutil.WriteFile(outputName, outputBuffer.Bytes(), os.ModePerm)
-	if err != nil {
-		return errors.Wrap(err, "unable to write csv data to file")
+	quotas := quota.NewTracker(quota.Limits{
+		Concurrent:   config.QuotaConcurrent,
+		HourlyCrawls: config.QuotaHourlyCrawls,
+		DailyPages:   config.QuotaDailyPages,
+	}, quota.Limits{
+		Concurrent:   config.ClientConcurrent,
+		HourlyCrawls: config.ClientHourlyCrawls,
+		DailyPages:   config.ClientDailyPages,
+	})
+	jobs.SetQuotas(quotas)
+	if config.CrawlCacheTTL > 0 {
+		jobs.SetCache(crawl.NewResultCache(config.CrawlCacheTTL, config.CrawlCacheSize))
 	}
 
-	return nil
-}
+	routes.SetMaxRenderDepth(config.RenderMaxDepth)
+	routes.SetCrawlTimeout(config.RouteCrawlTimeout)
+	routes.SetVerboseError(config.VerboseErrors)
 
-func processLink(r *colly.Response) (*Proposition, error) {
-	parent := r.Ctx.Get("parent")
-	labels, _ := getLabels(r)
-	fmt.Printf("Visiting %v\tParent %v\n", r.Request.URL, parent)
-	id, _ := createID()
-	return &Proposition{
-		ID:            id,
-		Tag:           labels[0],
-		PotentialTags: labels,
-		URL:           r.Request.URL.String(),
-		Key:           r.Request.URL.String(),
-		ParentURL:     parent,
-	}, nil
-}
+	// register routes
+	mux := goji.NewMux()
+	mux.Use(middleware.RequestID)
+	mux.Use(middleware.Log)
+	if authenticator != nil {
+		mux.Use(middleware.Auth(authenticator, routes.HandleError, "/site/", "/admin/"))
+	}
+	mux.Use(middleware.Gzip)
+	registerRoutePost(mux, "/site/treemap", routes.LinksHandler(allowedSites, jobs))
+	registerRoutePost(mux, "/site/treegraph", routes.TreeGraphHandler(allowedSites, jobs))
+	registerRoutePost(mux, "/site/linkgraph", routes.LinkGraphHandler(allowedSites, jobs))
+	registerRoutePost(mux, "/site/diff", routes.DiffHandler(allowedSites, jobs))
+	registerRoutePost(mux, "/site/propositions.csv", routes.PropositionsCSVHandler(allowedSites, jobs))
+	registerRoutePost(mux, "/site/propositions.xlsx", routes.PropositionsXLSXHandler(allowedSites, jobs))
+	registerRoutePost(mux, "/site/crawls", routes.CrawlStartHandler(allowedSites, jobs))
+	registerRoute(mux, "/site/crawls/:id", routes.CrawlStatusHandler(allowedSites, jobs))
+	registerRoute(mux, "/site/crawls/:id/events", routes.CrawlEventsHandler(allowedSites, jobs))
+	registerRouteDelete(mux, "/site/crawls/:id", routes.CrawlCancelHandler(allowedSites, jobs))
+	registerRoute(mux, "/site/results", routes.ResultListHandler(allowedSites, store))
+	registerRoute(mux, "/site/results/:id", routes.ResultHandler(allowedSites, store))
+	registerRouteDelete(mux, "/site/results", routes.ResultPruneHandler(store))
+	registerRouteDelete(mux, "/site/results/:id", routes.ResultDeleteHandler(store))
+	registerRoute(mux, "/admin/sites", routes.SiteListHandler(allowedSites))
+	registerRoutePost(mux, "/admin/sites", routes.SitePutHandler(allowedSites))
+	registerRouteDelete(mux, "/admin/sites/:site", routes.SiteDeleteHandler(allowedSites))
+	registerRoute(mux, "/admin/quotas", routes.QuotaHandler(quotas))
 
-func getLabels(r *colly.Response) ([]string, error) {
-	// very quick and dirty title grab
-	body := string(r.Body)
-	title := strings.TrimSpace(body[strings.Index(body, "<title>")+7 : strings.Index(body, "</title>")])
-	linkText := strings.TrimSpace(r.Ctx.Get("link"))
+	registerRoute(mux, "/*", routes.FileHandler("./dist"))
 
-	return []string{title, linkText}, nil
-}
+	// catch kill signals for graceful shutdown
+	graceful.AddSignal(syscall.SIGINT, syscall.SIGTERM)
 
-func createID() (string, error) {
-	uuid, err := uuid.NewV4()
+	// kick off the server listen loop
+	log.Infof("Listening on port %s", *port)
+	err = graceful.ListenAndServe(":"+*port, mux)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	return uuid.String(), nil
+	// wait until server gracefully exits
+	graceful.Wait()
+
+	return nil
 }
 
-type node struct {
-	key      string
-	children []*node
-	data     *Proposition
+// reloadOnHangup reloads the allowed sites and site rules whenever the process
+// receives a SIGHUP.
+func reloadOnHangup(allowedSites *sites.Registry, siteRules *crawl.SiteRuleFile) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		err := allowedSites.Reload()
+		if err != nil {
+			log.Errorf("keeping previous allowed sites: %+v", err)
+		}
+		err = siteRules.Reload()
+		if err != nil {
+			log.Errorf("keeping previous site rules: %+v", err)
+		}
+	}
 }
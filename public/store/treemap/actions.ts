@@ -4,38 +4,87 @@ import { ActionContext } from "vuex";
 import { treemapGetters } from "..";
 import store, { PropositionState } from "../store";
 import { getters, mutations } from "./module";
-import { TreemapState } from "./index";
+import { ApiError, TreemapState } from "./index";
 
 export type TreemapContext = ActionContext<TreemapState, PropositionState>;
 
+// toApiError returns the error envelope sent by the server, or wraps the
+// error message when the request failed before reaching it.
+function toApiError(error: any): ApiError {
+  const data = error?.response?.data;
+  if (data && data.code && data.message) {
+    return data as ApiError;
+  }
+  return { code: "request_failed", message: error?.message ?? String(error) };
+}
+
 export const actions = {
+  async startCrawl(context: TreemapContext, args: { url: string }) {
+    mutations.setError(context, null);
+    try {
+      const response = await axios.post(`/site/crawls`, {
+        url: args.url,
+      });
+      mutations.setCrawl(context, response.data);
+      mutations.clearCrawlPages(context);
+      // follow the crawl progress until the job ends
+      await new Promise<void>((resolve) => {
+        const source = new EventSource(
+          `/site/crawls/${response.data.id}/events`
+        );
+        source.addEventListener("page", (event: MessageEvent) => {
+          mutations.addCrawlPage(context, JSON.parse(event.data));
+        });
+        source.addEventListener("summary", (event: MessageEvent) => {
+          source.close();
+          mutations.setCrawl(context, JSON.parse(event.data));
+          resolve();
+        });
+        source.onerror = async () => {
+          source.close();
+          try {
+            const status = await axios.get(
+              `/site/crawls/${response.data.id}`
+            );
+            mutations.setCrawl(context, status.data);
+          } catch (error) {
+            mutations.setError(context, toApiError(error));
+          }
+          resolve();
+        };
+      });
+    } catch (error) {
+      mutations.setError(context, toApiError(error));
+      mutations.setCrawl(context, null);
+    }
+  },
   async fetchTreemap(
     context: TreemapContext,
-    args: { url: string; maxDepth: number }
+    args: { crawlId: string; maxDepth: number }
   ): Promise<void> {
     try {
       const response = await axios.post(`/site/treemap`, {
-        url: args.url,
+        crawlId: args.crawlId,
         maxDepth: args.maxDepth,
       });
       mutations.setTreemap(context, response.data);
     } catch (error) {
-      console.error(error);
+      mutations.setError(context, toApiError(error));
       mutations.setTreemap(context, null);
     }
   },
   async fetchTreegraph(
     context: TreemapContext,
-    args: { url: string; maxDepth: number }
+    args: { crawlId: string; maxDepth: number }
   ): Promise<void> {
     try {
       const response = await axios.post(`/site/treegraph`, {
-        url: args.url,
+        crawlId: args.crawlId,
         maxDepth: args.maxDepth,
       });
       mutations.setTreegraph(context, response.data);
     } catch (error) {
-      console.error(error);
+      mutations.setError(context, toApiError(error));
       mutations.setTreegraph(context, null);
     }
   },
@@ -1,5 +1,12 @@
 import { isInteger, values } from "lodash";
-import { TreemapState, Treemap, TreeGraph } from "./index";
+import {
+  ApiError,
+  CrawlJob,
+  CrawlPage,
+  TreemapState,
+  Treemap,
+  TreeGraph,
+} from "./index";
 
 export const getters = {
   getTreemap(state: TreemapState): Treemap {
@@ -8,4 +15,13 @@ export const getters = {
   getTreegraph(state: TreemapState): TreeGraph {
     return state.treegraph;
   },
+  getCrawl(state: TreemapState): CrawlJob {
+    return state.crawl;
+  },
+  getCrawlPages(state: TreemapState): CrawlPage[] {
+    return state.crawlPages;
+  },
+  getError(state: TreemapState): ApiError {
+    return state.error;
+  },
 };
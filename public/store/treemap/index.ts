@@ -1,5 +1,6 @@
 export interface TreeGraphItem {
   id: string;
+  code?: string;
   value: string;
 }
 
@@ -10,19 +11,57 @@ export interface TreeGraph {
 export interface Treemap {
   name: string;
   colName: string;
+  code?: string;
   children?: Node[];
   value?: number;
 }
 
+export interface CrawlJob {
+  id: string;
+  url: string;
+  status: string;
+  pagesVisited: number;
+  queueDepth: number;
+  errors: string[];
+  startTime: string;
+  endTime?: string;
+}
+
+export interface CrawlPage {
+  url: string;
+  parentUrl: string;
+  title: string;
+  depth: number;
+  statusCode: number;
+}
+
+export interface ApiErrorDetail {
+  field: string;
+  message: string;
+}
+
+export interface ApiError {
+  code: string;
+  message: string;
+  requestId?: string;
+  details?: ApiErrorDetail[];
+}
+
 export interface TreemapState {
   treemap: Treemap;
   treegraph: TreeGraph;
+  crawl: CrawlJob;
+  crawlPages: CrawlPage[];
+  error: ApiError;
 }
 
 export const defaultState = (): TreemapState => {
   return {
     treemap: null,
     treegraph: null,
+    crawl: null,
+    crawlPages: [],
+    error: null,
   };
 };
 
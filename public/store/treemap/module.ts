@@ -22,16 +22,24 @@ const { commit, read, dispatch } = getStoreAccessors<
 export const getters = {
   getTreemap: read(moduleGetters.getTreemap),
   getTreegraph: read(moduleGetters.getTreegraph),
+  getCrawl: read(moduleGetters.getCrawl),
+  getCrawlPages: read(moduleGetters.getCrawlPages),
+  getError: read(moduleGetters.getError),
 };
 
 // Typed actions
 export const actions = {
   fetchTreemap: dispatch(moduleActions.fetchTreemap),
   fetchTreegraph: dispatch(moduleActions.fetchTreegraph),
+  startCrawl: dispatch(moduleActions.startCrawl),
 };
 
 // Typed mutations
 export const mutations = {
   setTreemap: commit(moduleMutations.setTreemap),
   setTreegraph: commit(moduleMutations.setTreegraph),
+  setCrawl: commit(moduleMutations.setCrawl),
+  clearCrawlPages: commit(moduleMutations.clearCrawlPages),
+  addCrawlPage: commit(moduleMutations.addCrawlPage),
+  setError: commit(moduleMutations.setError),
 };
@@ -1,6 +1,14 @@
 import _ from "lodash";
 import Vue from "vue";
-import { defaultState, TreemapState, Treemap, TreeGraph } from "./index";
+import {
+  defaultState,
+  ApiError,
+  CrawlJob,
+  CrawlPage,
+  TreemapState,
+  Treemap,
+  TreeGraph,
+} from "./index";
 
 export const mutations = {
   setTreemap(state: TreemapState, treemap: Treemap) {
@@ -15,6 +23,18 @@ export const mutations = {
     }
     state.treegraph = treegraph;
   },
+  setCrawl(state: TreemapState, crawl: CrawlJob) {
+    state.crawl = crawl;
+  },
+  clearCrawlPages(state: TreemapState) {
+    state.crawlPages = [];
+  },
+  addCrawlPage(state: TreemapState, page: CrawlPage) {
+    state.crawlPages.push(page);
+  },
+  setError(state: TreemapState, error: ApiError) {
+    state.error = error;
+  },
   resetState(state: TreemapState) {
     Object.assign(state, defaultState());
   },
@@ -1,5 +1,26 @@
 import * as d3 from "d3";
-import { Treemap, TreeGraph } from "../store/treemap/index";
+import {
+  CrawlPage,
+  Treemap,
+  TreeGraph,
+  TreeGraphItem,
+} from "../store/treemap/index";
+
+// builds a treegraph from the pages of a crawl that is still running
+export function pagesToTreegraph(pages: CrawlPage[]): TreeGraph {
+  const ids = new Map<string, string>();
+  ids.set("", "HOME");
+  const items: TreeGraphItem[] = [{ id: "HOME", value: null }];
+  pages.forEach((page) => {
+    const parentId = ids.get(page.parentUrl) || "HOME";
+    const id = `${parentId}.${page.title}`;
+    ids.set(page.url, id);
+    if (!items.some((item) => item.id === id)) {
+      items.push({ id: id, value: null });
+    }
+  });
+  return { items: items };
+}
 
 export function graphTreegraph(rootTag: string, treegraphData: TreeGraph) {
   var margin = { top: 20, right: 40, bottom: 20, left: 40 };
@@ -76,6 +97,10 @@ export function graphTreegraph(rootTag: string, treegraphData: TreeGraph) {
     })
     .text(function (d) {
       return d.id.substring(d.id.lastIndexOf(".") + 1);
+    })
+    .append("title")
+    .text(function (d: any) {
+      return d.data.code || "";
     });
 }
 
@@ -132,7 +157,11 @@ export function graphTreemap(rootTag: string, treemapData: Treemap) {
       //return 0;
     })
     .style("stroke", "black")
-    .style("fill", "slateblue");
+    .style("fill", "slateblue")
+    .append("title")
+    .text(function (d: any) {
+      return d.data.code ? `${d.data.code} ${d.data.name}` : d.data.name;
+    });
 
   // and to add the text labels
   svg